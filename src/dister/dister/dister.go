@@ -27,7 +27,7 @@ import (
 )
 
 const (
-    gVERSION                                = "1.6"   // 当前版本
+    gVERSION                                = "1.7"   // 当前版本
     gDEBUG                                  = false   // 用于控制调试信息(开发阶段使用)
     gCOMPRESS_COMMUNICATION                 = false   // 是否在通信时进行内容压缩(开发阶段使用)
     gCOMPRESS_SAVING                        = false   // 是否在存储时压缩内容(开发阶段使用)
@@ -38,6 +38,7 @@ const (
     gPORT_RAFT                              = 4166    // 集群协议通信接口
     gPORT_REPL                              = 4167    // 集群数据同步接口
     gPORT_API                               = 4168    // 服务器对外API接口
+    gPORT_MONITOR                           = 4169    // monitor节点对外的只读监控接口
 
     // 节点状态
     gSTATUS_DEAD                            = 0
@@ -47,24 +48,70 @@ const (
     gROLE_SERVER                            = 0
     gROLE_CLIENT                            = 1
     gROLE_MONITOR                           = 2
+    gROLE_WITNESS                           = 3
 
     // RAFT角色
     gROLE_RAFT_FOLLOWER                     = 0
     gROLE_RAFT_CANDIDATE                    = 1
     gROLE_RAFT_LEADER                       = 2
 
+    // 选举模式
+    gELECTION_MODE_SCORE                    = "score" // 延迟比分选举(默认)
+    gELECTION_MODE_RAFT                     = "raft"  // 标准RAFT任期及RequestVote投票选举
+
+    // 写入持久化级别，决定leader提交写入时需要等待写入成功的server节点数量
+    gDURABILITY_LEADER                      = "leader" // leader写入即返回，由数据同步线程异步同步到其他节点
+    gDURABILITY_ONE                         = "one"    // 至少一个其他server节点写入成功
+    gDURABILITY_QUORUM                      = "quorum" // 多数派(包含leader)server节点写入成功(默认)
+    gDURABILITY_ALL                         = "all"    // 所有server节点写入成功
+
     // 超时时间设置
     gTCP_RETRY_COUNT                        = 0       // TCP请求失败时的重试次数
     gTCP_CONN_TIMEOUT                       = 3000    // (毫秒)TCP建立链接超时
     gTCP_READ_TIMEOUT                       = 6000    // (毫秒)TCP链接读取超时
     gELECTION_TIMEOUT                       = 2000    // (毫秒)RAFT选举超时时间(如果Leader挂掉之后到重新选举的时间间隔)
     gELECTION_TIMEOUT_HEARTBEAT             = 500     // (毫秒)RAFT Leader统治维持心跳间隔
+    gELECTION_TIMEOUT_RANDOM                = 1500    // (毫秒)raft选举模式下选举超时时间的随机增量上限，避免多个节点同时发起选举
+    gELECTION_CHECK_INTERVAL                = 100     // (毫秒)raft选举模式下选举超时的检查间隔
     gLOG_REPL_DATA_UPDATE_INTERVAL          = 1000    // (毫秒)数据同步间隔
     gLOG_REPL_SERVICE_UPDATE_INTERVAL       = 2000    // (毫秒)Service同步检测心跳间隔
     gLOG_REPL_AUTOSAVE_INTERVAL             = 1000    // (毫秒)数据自动物理化保存的间隔(更新时会做更新判断)
     gLOG_REPL_LOGCLEAN_INTERVAL             = 5000    // (毫秒)LogList定期清理过期(已同步)的日志列表
     gLOG_REPL_PEERS_INTERVAL                = 5000    // (毫秒)Peers节点信息同步(非完整同步)
+    gLOG_REPL_EXPIRE_INTERVAL               = 1000    // (毫秒)leader检查并删除过期键值、失效会话的间隔
+    gLOG_REPL_APPEND_RETRY                  = 3       // 写入时目标节点日志不一致，修复目标节点日志之后最多尝试写入的次数
+    gLOG_COMPACT_INTERVAL                   = 60000   // (毫秒)日志压缩检查的间隔
+    gLOG_COMPACT_RETAIN                     = 100000  // 日志压缩时默认在安全点之前保留的日志数量
+    gSESSION_TTL_MIN                        = 5       // (秒)会话保持时间的最小值
+    gSESSION_TTL_MAX                        = 86400   // (秒)会话保持时间的最大值
     gSERVICE_HEALTH_CHECK_INTERVAL          = 2000    // (毫秒)健康检查默认间隔
+    gWATCH_TIMEOUT                          = 30000   // (毫秒)KV监听(watch)默认的长轮询等待时间
+    gWATCH_TIMEOUT_MAX                      = 300000  // (毫秒)KV监听(watch)最大的长轮询等待时间
+    gLOCK_WAIT_TIMEOUT_MAX                  = 300000  // (毫秒)分布式锁最大的阻塞等待时间
+    gLOCK_WAIT_CHECK_INTERVAL               = 100     // (毫秒)分布式锁阻塞等待时检查锁状态的间隔
+    gREAD_INDEX_WAIT_TIMEOUT                = 5000    // (毫秒)一致性读取时follower等待本地日志追上leader的最长时间
+    gLEADER_TRANSFER_TIMEOUT                = 10000   // (毫秒)leader转移时等待目标节点日志追上leader的最长时间
+    gMEMBER_CATCHUP_TIMEOUT                 = 30000   // (毫秒)添加投票成员时等待新节点日志追上leader的最长时间
+    gLEADER_PRIORITY_CHECK_INTERVAL         = 5000    // (毫秒)leader检查是否存在优先级更高的投票成员的间隔
+    gLEADER_PRIORITY_MAX_LAG                = 100     // 按照优先级转移leader时，目标节点允许落后的最大日志数量
+    gLEADER_PRIORITY_BACKOFF_MAX            = 300000  // (毫秒)按照优先级转移leader连续失败时，两次转移之间的最长退避时间
+    gELECTION_KEY_PREFIX                    = "dister/election/" // 应用选举的当选信息在KV中的键名前缀，同时也是选举使用的分布式锁名称前缀
+
+    // KV列表查询
+    gKV_LIST_LIMIT                          = 100     // KV列表查询默认的每页数量
+    gKV_LIST_LIMIT_MAX                      = 1000    // KV列表查询最大的每页数量
+    gKV_IMPORT_BATCH_SIZE                   = 1000    // KV导入时每个LogEntry写入的最大键值数量
+    gAUDIT_LIMIT                            = 100     // 审计查询默认返回的最大记录数量
+    gAUDIT_LIMIT_MAX                        = 10000   // 审计查询最大返回的记录数量
+    gAPI_RESULT_NOT_FOUND                   = 2       // KV元数据查询时键名不存在(或者已过期)的API返回码，调用方不需要依赖错误信息判断
+
+    // 集群监控(monitor节点)
+    gMONITOR_INTERVAL                       = 2000    // (毫秒)monitor节点探测集群各节点的间隔
+    gMONITOR_EVENTS_MAX                     = 10000   // monitor节点保留的最近监控事件数量
+    gMONITOR_SAMPLES_MAX                    = 1800    // monitor节点保留的最近周期采样数量(默认探测间隔下约1小时)
+    gMONITOR_LAG_WARNING                    = 1000    // server节点落后leader的日志数量超过该值时记录复制延迟事件
+    gMONITOR_LIMIT                          = 100     // 监控查询默认返回的最大记录数量
+    gMONITOR_LIMIT_MAX                      = 10000   // 监控查询最大返回的记录数量
 
     // RAFT操作
     gMSG_RAFT_HI                            = 110
@@ -82,6 +129,10 @@ const (
     gMSG_RAFT_LEADER_COMPARE_REQUEST        = 230
     gMSG_RAFT_LEADER_COMPARE_FAILURE        = 240
     gMSG_RAFT_LEADER_COMPARE_SUCCESS        = 250
+    gMSG_RAFT_VOTE_REQUEST                  = 260
+    gMSG_RAFT_VOTE_GRANTED                  = 270
+    gMSG_RAFT_VOTE_REJECTED                 = 280
+    gMSG_RAFT_TERM_EXPIRED                  = 290
 
     // 数据同步操作
     gMSG_REPL_DATA_SET                      = 300
@@ -94,6 +145,16 @@ const (
     gMSG_REPL_PEERS_UPDATE                  = 370
     gMSG_REPL_CONFIG_FROM_FOLLOWER          = 380
     gMSG_REPL_SERVICE_UPDATE                = 390
+    gMSG_REPL_DATA_CAS                      = 400
+    gMSG_REPL_DATA_SET_TTL                  = 410
+    gMSG_REPL_SESSION_CREATE                = 420
+    gMSG_REPL_SESSION_DESTROY               = 430
+    gMSG_REPL_DATA_SET_SESSION              = 440
+    gMSG_REPL_DATA_TXN                      = 450
+    gMSG_REPL_LOCK_ACQUIRE                  = 460
+    gMSG_REPL_LOCK_RELEASE                  = 470
+    gMSG_REPL_ELECTION_CAMPAIGN             = 480
+    gMSG_REPL_ELECTION_RESIGN               = 490
 
     // API相关
     gMSG_API_DATA_GET                       = 500
@@ -102,12 +163,43 @@ const (
     gMSG_API_SERVICE_GET                    = 530
     gMSG_API_SERVICE_SET                    = 540
     gMSG_API_SERVICE_REMOVE                 = 550
+    gMSG_API_DATA_WATCH                     = 560
+    gMSG_API_DATA_LIST                      = 570
+    gMSG_API_DATA_META                      = 580
+    gMSG_API_SESSION_GET                    = 590
+    gMSG_API_SESSION_RENEW                  = 600
+    gMSG_API_DATA_HISTORY                   = 610
+    gMSG_API_LOCK_GET                       = 620
+    gMSG_API_ELECTION_OBSERVE               = 630
+    gMSG_API_READ_INDEX                     = 640
+    gMSG_API_DATA_IMPORT                    = 650
+    gMSG_API_AUDIT                          = 660
+    gMSG_API_USAGE                          = 670
+    gMSG_API_LEADER_TRANSFER                = 680
+
+    // 数据同步操作(续)
+    gMSG_REPL_SNAPSHOT_INSTALL              = 700
+    gMSG_REPL_TERM_EXPIRED                  = 710
+    gMSG_REPL_MEMBER_ADD                    = 720
+    gMSG_REPL_MEMBER_REMOVE                 = 730
+
+    // RAFT操作(续)
+    gMSG_RAFT_TIMEOUT_NOW                   = 800
+    gMSG_RAFT_FAILED                        = 810
+    gMSG_RAFT_PREVOTE_REQUEST               = 820
+    gMSG_RAFT_PREVOTE_GRANTED               = 830
+    gMSG_RAFT_PREVOTE_REJECTED              = 840
+    gMSG_RAFT_LEADER_CONFIRM_REQUEST        = 850
+    gMSG_RAFT_LEADER_CONFIRM_SUCCESS        = 860
+    gMSG_RAFT_LEADER_CONFIRM_FAILURE        = 870
 )
 
 // 服务器节点信息
 type Node struct {
     mutex                sync.RWMutex             // 通用锁，可以使用不同的锁来控制对应变量以提高读写效率
     dmutex               sync.RWMutex             // DataMap锁，用以保证KV请求的先进先出队列执行
+    tmutex               sync.Mutex               // RAFT任期锁，保证任期及投票的检查、修改与持久化为原子操作
+    mmutex               sync.RWMutex             // 监控历史锁(monitor节点)
 
     Group                string                   // 集群名称
     Id                   string                   // 节点ID(根据算法自动生成的集群唯一名称)
@@ -116,7 +208,9 @@ type Node struct {
                                                  // 一个节点可能会有多个IP，这里保存最近通信的那个，节点唯一性识别使用的是Name字段
     CfgFilePath          string                   // 配置文件绝对路径
     CfgReplicated        bool                     // 本地配置对象是否已同步到leader(配置同步需要注意覆盖问题)
+    CfgPeers             []string                 // 配置中的节点IP列表(Peers)，用于初始化投票成员表
     Peers                *gmap.StringInterfaceMap // 集群所有的节点信息(ip->节点信息)，不包含自身
+    Voters               *gmap.StringInterfaceMap // 投票成员表(节点ID->Member)，通过日志复制进行变更，为空表示所有server节点均为投票成员
     Role                 int32                    // 集群角色
     RaftRole             int32                    // RAFT角色
     Leader               *NodeInfo                // Leader节点信息
@@ -124,16 +218,46 @@ type Node struct {
     Score                int64                    // 选举比分
     ScoreCount           int32                    // 选举比分的节点数
     ElectionDeadline     int64                    // 选举超时时间点
+    Election             string                   // 选举模式(score/raft)，集群中所有Server节点应当使用相同的设置
+    LeaderPriority       int32                    // 成为leader的优先级，数值越大越优先，默认为0
+    Zone                 string                   // (可选)区域标签，例如机房名称
+    TrustedProxies       []string                 // (可选)受信任的代理IP列表，只有来自这些代理的请求才使用X-Forwarded-For请求头中的客户端IP
+    CurrentTerm          int64                    // 当前任期(raft选举模式)，持久化存储
+    VotedFor             string                   // 当前任期内投票的节点ID(raft选举模式)，持久化存储
+    LeaderSince          int64                    // 成为leader的时间点(毫秒)，用于check-quorum
+    HeartbeatAcks        *gmap.StringInterfaceMap // leader收到各节点接受心跳回复的时间点(节点ID->毫秒时间戳)，用于check-quorum
+    MonitorEvents        []MonitorEvent           // 监控事件的滚动历史，按时间升序(monitor节点)
+    MonitorSamples       []MonitorSample          // 周期采样的滚动历史，按时间升序(monitor节点)
     AutoScan             bool                     // 启动时自动扫描局域网，添加dister节点
 
     LogIdIndex           int64                    // 用于生成LogId的参考字段
     LastLogId            int64                    // 最后一次保存log的id，用以数据一致性判断
+    LastLogTerm          int64                    // 最后一次保存log的任期，选举时与LastLogId一起判断日志新旧
+    AppliedLogId         int64                    // 已应用到DataMap等内存数据的最大logid，读取请求只能读到该logid之前的数据
+    AppliedLogTerm       int64                    // 已应用的最后一条log的任期，与AppliedLogId一起记录到数据快照中
+    MatchLogId           int64                    // 本地日志中已确认与leader一致的最大logid(follower)
+    LeaderCommitLogId    int64                    // 从leader消息头中获取的已提交logid(follower)
+    PendingLogEntries    []LogEntry               // 已写入日志但尚未提交应用的LogEntry，按logid升序，使用dmutex锁保护
     LastServiceLogId     int64                    // 最后一次保存的service id号，用以识别本地Service数据是否已更新，不做Leader与Follower的同步数据
+    CommitLogId          int64                    // 已提交(多数派server节点已写入)的最大logid，由leader计算，follower根据leader的消息及本地日志确认
+    SnapshotLogId        int64                    // 最后一次成功保存到磁盘的数据快照对应的logid
+    CompactLogId         int64                    // 日志压缩点，小于该logid的日志文件已被归档或者删除
+    LogCompact           bool                     // 是否开启日志压缩
+    LogRetain            int64                    // 日志压缩时在安全点之前保留的日志数量
+    LogArchivePath       string                   // 日志压缩时的归档目录，为空表示直接删除
     LogList              *glist.SafeList          // 日志列表，用以存储临时的消息日志，以便快速进行数据同步到其他节点，仅在Leader节点存储
     ServiceList          *glist.SafeList          // Service同步事件列表，用以Service同步
     SavePath             string                   // 物理存储的本地数据*目录*绝对路径
     Service              *gmap.StringInterfaceMap // 存储的服务配置表
     DataMap              *gmap.StringStringMap    // 存储的K-V哈希表
+    DataSize             int64                    // K-V数据的总字节数(键名与键值长度之和)
+    Quota                KvQuota                  // K-V配额限制，由leader在写入时检查
+    DataMeta             *gmap.StringInterfaceMap // K-V的元数据表(键名->KvMeta)
+    DataExpire           *gmap.StringInterfaceMap // 设置了过期时间的键名表(键名->过期时间点)，由DataMeta生成，用于leader检查过期
+    Sessions             *gmap.StringInterfaceMap // 会话表(会话ID->Session)，与DataMap一起存储
+    SessionDeadline      *gmap.StringInterfaceMap // 会话失效时间点表(会话ID->毫秒时间戳)，仅在leader内存中维护，不做同步
+    Locks                *gmap.StringInterfaceMap // 分布式锁表(锁名称->Lock)，与DataMap一起存储
+    Watchers             *gmap.StringInterfaceMap // KV数据监听对象表，用于watch长轮询接口
 }
 
 // 服务节点对象(用于程序更新及检索结构)
@@ -154,6 +278,71 @@ type NodeApiKv struct {
     node *Node
 }
 
+// 用于KV监听API接口的对象
+type NodeApiWatch struct {
+    node *Node
+}
+
+// 用于KV比较并设置API接口的对象
+type NodeApiCas struct {
+    node *Node
+}
+
+// 用于会话API接口的对象
+type NodeApiSession struct {
+    node *Node
+}
+
+// 用于KV事务API接口的对象
+type NodeApiTxn struct {
+    node *Node
+}
+
+// 用于KV历史查询API接口的对象
+type NodeApiHistory struct {
+    node *Node
+}
+
+// 用于分布式锁API接口的对象
+type NodeApiLock struct {
+    node *Node
+}
+
+// 用于应用选举API接口的对象
+type NodeApiElection struct {
+    node *Node
+}
+
+// 用于KV导出API接口的对象
+type NodeApiExport struct {
+    node *Node
+}
+
+// 用于KV导入API接口的对象
+type NodeApiImport struct {
+    node *Node
+}
+
+// 用于写入审计API接口的对象
+type NodeApiAudit struct {
+    node *Node
+}
+
+// 用于K-V用量API接口的对象
+type NodeApiUsage struct {
+    node *Node
+}
+
+// 用于leader查询及转移API接口的对象
+type NodeApiLeader struct {
+    node *Node
+}
+
+// 用于集群监控API接口的对象
+type NodeApiMonitor struct {
+    node *Node
+}
+
 // 用于Node API接口的对象
 type NodeApiNode struct {
     node *Node
@@ -180,6 +369,10 @@ type NodeInfo struct {
     RaftRole         int32  `json:"raft"`
     LastLogId        int64  `json:"logid"`
     LastServiceLogId int64  `json:"serviceid"`
+    Term             int64  `json:"term"`
+    CommitLogId      int64  `json:"commitid"`
+    LeaderPriority   int32  `json:"priority"`
+    Zone             string `json:"zone"`
     Version          string `json:"version"`
 }
 
@@ -187,14 +380,326 @@ type NodeInfo struct {
 type LogEntry struct {
     Id               int64                  // 唯一ID
     Act              int
+    Term             int64                  // leader提交时的任期，用于选举时判断日志新旧
     Items            interface{}            // map[string]string或[]string
+    Origin           *LogOrigin             // 写入来源，由leader在提交时记录
+}
+
+// 写入来源(用于审计)
+type LogOrigin struct {
+    Node             string `json:"node"`   // 接收写入请求的节点ID
+    Name             string `json:"name"`   // 接收写入请求的节点名称
+    Ip               string `json:"ip"`     // 客户端IP，经过受信任的代理访问时为X-Forwarded-For请求头中的客户端IP
+    Remote           string `json:"remote,omitempty"` // 请求连接的来源IP(RemoteAddr)，经过代理访问时为代理的IP
+    User             string `json:"user"`   // 客户端提交的用户(X-Dister-User请求头)
+    Reason           string `json:"reason"` // 客户端提交的修改原因(X-Dister-Reason请求头)
+    Time             int64  `json:"time"`   // leader提交的时间(毫秒时间戳)
+    Durability       string `json:"durability,omitempty"` // 客户端指定的写入持久化级别(durability参数或者X-Dister-Durability请求头)，为空表示quorum
+}
+
+// 投票成员
+type Member struct {
+    Id               string `json:"id"`
+    Name             string `json:"name"`
+    Ip               string `json:"ip"`
+}
+
+// 投票成员变更结果
+type MemberChange struct {
+    Id               string `json:"id"`
+    Name             string `json:"name"`
+    Ip               string `json:"ip"`
+    LogId            int64  `json:"logid"`  // 变更提交的logid，为0表示未产生变更日志
+    Result           string `json:"result"`
+}
+
+// 监控事件
+type MonitorEvent struct {
+    Time             int64  `json:"time"`   // 发现变化的时间(毫秒时间戳)
+    Type             string `json:"type"`   // 事件类型：leader/peer/lag/service
+    Node             string `json:"node"`   // 相关的节点名称，服务事件为服务节点的键名
+    From             string `json:"from"`   // 变化之前的状态
+    To               string `json:"to"`     // 变化之后的状态
+    Detail           string `json:"detail"`
+}
+
+// 监控周期采样
+type MonitorSample struct {
+    Time             int64            `json:"time"`
+    Leader           string           `json:"leader"`   // leader节点名称，为空表示没有leader
+    Term             int64            `json:"term"`
+    LastLogId        int64            `json:"logid"`    // leader的LastLogId
+    CommitLogId      int64            `json:"commitid"` // leader的已提交logid
+    Alive            int              `json:"alive"`    // 存活的节点数量
+    Total            int              `json:"total"`    // 节点总数(不包含monitor节点自身)
+    Lags             map[string]int64 `json:"lags"`     // server节点名称->落后leader的日志数量
+}
+
+// 监控查询条件
+type MonitorQuery struct {
+    Type             string // 事件类型，为空表示所有类型
+    Since            int64  // 只查询该时间(毫秒时间戳，包含)之后的事件及采样
+    Limit            int    // 事件及采样分别最多返回最近的记录数量
+}
+
+// 监控查询结果
+type MonitorReport struct {
+    Status           *MonitorSample  `json:"status"`  // 最近一次采样，尚未采样时为空
+    Peers            []NodeInfo      `json:"peers"`   // 最近一次探测到的节点信息
+    Events           []MonitorEvent  `json:"events"`
+    Samples          []MonitorSample `json:"samples"`
+}
+
+// 写入审计查询条件
+type AuditQuery struct {
+    Key              string `json:"k"`      // 键名，为空表示查询所有写入
+    Prefix           bool   `json:"prefix"` // 是否按照键名前缀匹配
+    Since            int64  `json:"since"`  // 只查询该时间(毫秒时间戳，包含)之后的写入
+    Limit            int    `json:"limit"`  // 最多返回最近的记录数量
+}
+
+// 写入审计记录
+type AuditRecord struct {
+    Id               int64        `json:"logid"`
+    Act              string       `json:"act"`
+    Events           []WatchEvent `json:"events"` // 该写入产生的数据变化事件(非KV写入时为空)
+    Origin           *LogOrigin   `json:"origin"`
+}
+
+// 写入审计查询结果，记录按照logid升序排列
+type AuditResult struct {
+    Records          []AuditRecord `json:"records"`
+    Compacted        int64         `json:"compacted"` // 检索到本地最早的日志时为日志压缩点，该logid之前的写入已被压缩无法查询，为0表示记录完整
+}
+
+// K-V配额限制，为0表示不限制
+type KvQuota struct {
+    MaxKeyLength     int    `json:"maxkeylength"` // 键名最大长度(字节)
+    MaxValueSize     int    `json:"maxvaluesize"` // 键值最大长度(字节)
+    MaxKeys          int    `json:"maxkeys"`      // 最大键值数量
+    MaxDataSize      int64  `json:"maxdatasize"`  // 最大数据总字节数(键名与键值长度之和)
+}
+
+// K-V用量
+type KvUsage struct {
+    Keys             int     `json:"keys"`     // 键值数量
+    DataSize         int64   `json:"datasize"` // 数据总字节数
+    Quota            KvQuota `json:"quota"`    // leader的配额限制
+}
+
+// 键值对的元数据
+type KvMeta struct {
+    CreateId         int64  `json:"create"`  // 创建该键值的LogEntry ID(键值被删除后重新设置时重新计算)
+    ModifyId         int64  `json:"modify"`  // 最后一次修改该键值的LogEntry ID
+    Version          int64  `json:"version"` // 键值版本号，创建时为1，每次修改加1
+    Expire           int64  `json:"expire"`  // 过期时间点(毫秒时间戳)，为0表示永不过期
+    Session          string `json:"session"` // 绑定的会话ID，会话失效时该键值将被删除
+}
+
+// 带元数据的键值详情
+type KvDetail struct {
+    Key              string `json:"k"`
+    Value            string `json:"v"`
+    Ttl              int64  `json:"ttl"` // 剩余的生存时间(秒)，为0表示永不过期
+    KvMeta
+}
+
+// 带过期时间的KV设置(gMSG_REPL_DATA_SET_TTL)日志项
+type KvTtlItems struct {
+    Items            map[string]string `json:"items"`
+    Ttl              int64             `json:"ttl"`    // 生存时间(秒)，由API提交给leader
+    Expire           int64             `json:"expire"` // 过期时间点(毫秒时间戳)，由leader根据Ttl计算生成
+}
+
+// KV比较并设置(compare-and-swap)请求，Prev与LogId至少需要给定一项
+type KvCas struct {
+    Key              string  `json:"k"`
+    Value            string  `json:"v"`
+    Prev             *string `json:"prev"`  // 期望的当前键值，为nil表示不比较键值
+    LogId            *int64  `json:"logid"` // 期望的键值最后修改logid，为nil表示不比较，为0表示键名必须不存在
+}
+
+// KV比较并设置(compare-and-swap)结果
+type KvCasResult struct {
+    Succeeded        bool   `json:"succeeded"` // 是否比较成功并写入
+    LogId            int64  `json:"logid"`     // 写入成功时的logid
+    Exist            bool   `json:"exist"`     // 比较时键名是否存在
+    Value            string `json:"v"`         // 比较时的键值
+    ModifyId         int64  `json:"modify"`    // 比较时键值最后修改的logid
+}
+
+// 绑定会话的KV设置(gMSG_REPL_DATA_SET_SESSION)日志项
+type KvSessionItems struct {
+    Items            map[string]string `json:"items"`
+    Session          string            `json:"session"`
+}
+
+// 会话，客户端需要在会话保持时间内定期续期，否则会话失效，并且绑定该会话的键值将被leader删除
+type Session struct {
+    Id               string `json:"id"`
+    Name             string `json:"name"`   // 会话名称(可选)，用于识别会话的所有者
+    Ttl              int64  `json:"ttl"`    // 会话保持时间(秒)
+    CreateId         int64  `json:"create"` // 创建该会话的LogEntry ID
+}
+
+// 会话销毁(gMSG_REPL_SESSION_DESTROY)日志项
+type SessionDestroyItems struct {
+    Id               string   `json:"id"`
+    Keys             []string `json:"keys"` // 绑定该会话需要删除的键名列表，由leader生成
+    Winners          []KvSessionItems `json:"winners,omitempty"` // 会话释放选举锁后新当选者的当选信息，由leader生成
+}
+
+// KV事务，当所有比较条件成立时执行Then操作列表，否则执行Else操作列表，操作结果作为一个LogEntry写入
+type KvTxn struct {
+    Compare          []KvTxnCompare `json:"compare"`
+    Then             []KvTxnOp      `json:"then"`
+    Else             []KvTxnOp      `json:"else"`
+}
+
+// KV事务比较条件，v与logid只能给定其一，logid为0时表示键名不存在
+type KvTxnCompare struct {
+    Key              string  `json:"k"`
+    Op               string  `json:"op"`    // 比较操作符：=(默认), !=, >, <
+    Value            *string `json:"v"`     // 与当前键值比较(字符串比较)，键名不存在时比较不成立
+    LogId            *int64  `json:"logid"` // 与键值最后修改的logid比较
+}
+
+// KV事务操作
+type KvTxnOp struct {
+    Op               string `json:"op"` // 操作类型：set, delete
+    Key              string `json:"k"`
+    Value            string `json:"v"`
+}
+
+// KV事务(gMSG_REPL_DATA_TXN)日志项，由leader根据比较结果生成
+type KvTxnItems struct {
+    Set              map[string]string `json:"set"`
+    Remove           []string          `json:"remove"`
+}
+
+// KV事务执行结果
+type KvTxnResult struct {
+    Succeeded        bool   `json:"succeeded"` // 比较条件是否全部成立(即执行的是Then还是Else操作列表)
+    LogId            int64  `json:"logid"`     // 写入的logid，没有写入操作时为0
+}
+
+// 分布式锁，锁的持有者及等待者均为会话，会话失效时自动释放锁或者退出等待
+type Lock struct {
+    Name             string   `json:"name"`
+    Owner            string   `json:"owner"`   // 持有锁的会话ID
+    Token            int64    `json:"token"`   // 防护令牌(fencing token)，即获得锁的LogEntry ID，严格递增
+    Waiters          []string `json:"waiters"` // 按照先进先出顺序等待锁的会话ID列表
+    Values           map[string]string `json:"values,omitempty"` // 选举锁中等待会话当选后公布的信息，按照会话ID索引
+}
+
+// 分布式锁获取/释放(gMSG_REPL_LOCK_ACQUIRE/gMSG_REPL_LOCK_RELEASE)请求及日志项
+type LockRequest struct {
+    Name             string `json:"name"`
+    Session          string `json:"session"`
+    Timeout          int64  `json:"timeout,omitempty"` // (毫秒)获取锁时的阻塞等待时间，为0表示不等待
+    Value            string `json:"value,omitempty"`   // 选举锁：会话当选后公布的信息
+    Winners          []KvSessionItems `json:"winners,omitempty"` // 选举锁：由leader生成的新当选者的当选信息，与锁的交接在同一日志项中写入
+}
+
+// 分布式锁操作结果
+type LockResult struct {
+    Acquired         bool   `json:"acquired"` // 请求的会话是否持有锁
+    Lock
+}
+
+// 应用选举竞选/退选请求
+type ElectionRequest struct {
+    Name             string `json:"name"`
+    Session          string `json:"session"`
+    Value            string `json:"value"`             // 当选后公布的信息，例如实例的访问地址
+    Timeout          int64  `json:"timeout,omitempty"` // (毫秒)竞选时的阻塞等待时间，为0表示不等待
+}
+
+// 应用选举的当选信息
+type Election struct {
+    Name             string `json:"name"`
+    Session          string `json:"session"` // 当选的会话ID，为空表示当前没有当选者
+    Value            string `json:"value"`   // 当选者公布的信息
+    Token            int64  `json:"token"`   // 当选的防护令牌，即选举锁的防护令牌
+    LogId            int64  `json:"logid"`   // 查询时的logid，用于下一次阻塞观察请求
+}
+
+// KV导入请求
+type KvImport struct {
+    Items            map[string]string `json:"items"`
+    DryRun           bool              `json:"dryrun"` // 只比较差异，不写入数据
+}
+
+// KV导入时键值的变化
+type KvImportChange struct {
+    Key              string `json:"k"`
+    Old              string `json:"old"`
+    New              string `json:"new"`
+}
+
+// KV导入结果，导入只新增或者修改键值，不删除已有的键值
+type KvImportResult struct {
+    Added            []string         `json:"added"`     // 新增的键名列表
+    Changed          []KvImportChange `json:"changed"`   // 修改的键值列表
+    Unchanged        int              `json:"unchanged"` // 键值未变化的数量
+    LogIds           []int64          `json:"logids"`    // 写入的logid列表，dry-run时为空
+}
+
+// KV列表查询条件，键名按照字典序升序排列
+type KvQuery struct {
+    Prefix           string `json:"prefix"` // 键名前缀
+    Start            string `json:"start"`  // 键名范围开始(包含)
+    End              string `json:"end"`    // 键名范围结束(不包含)
+    Cursor           string `json:"cursor"` // 分页游标，只返回键名大于该游标的数据
+    Limit            int    `json:"limit"`  // 每页数量
+}
+
+// KV列表查询的键值项
+type KvItem struct {
+    Key              string `json:"k"`
+    Value            string `json:"v"`
+}
+
+// KV列表查询结果
+type KvList struct {
+    List             []KvItem `json:"list"`
+    Next             string   `json:"next"` // 下一页的分页游标，为空表示没有更多数据
+}
+
+// KV数据变化事件(用于watch接口)
+type WatchEvent struct {
+    Id               int64  `json:"logid"` // 产生该事件的LogEntry ID
+    Act              string `json:"act"`   // set 或者 remove
+    Key              string `json:"k"`
+    Value            string `json:"v"`
+}
+
+// KV数据监听结果(用于watch接口)
+type WatchResult struct {
+    LogId            int64        `json:"logid"`     // 已检索到的最大logid，用于下一次监听请求
+    Events           []WatchEvent `json:"events"`
+    Compacted        int64        `json:"compacted"` // 监听的logid之前的日志已被压缩时为日志压缩点，中间的变化无法返回，调用方需要重新读取完整数据
+}
+
+// KV历史查询条件
+type KvHistoryQuery struct {
+    Key              string `json:"k"`
+    At               int64  `json:"at"` // 只查询该logid(包含)之前的变化，为0表示查询所有变化
+}
+
+// KV历史查询结果，变化事件按照logid升序排列
+type KvHistory struct {
+    Key              string       `json:"k"`
+    Events           []WatchEvent `json:"events"`
+    Compacted        int64        `json:"compacted"` // 日志压缩点，该logid之前的变化已被压缩，为0表示历史完整
 }
 
 // 消息
 type Msg struct {
-    Head int
-    Body []byte
-    Info NodeInfo
+    Head   int
+    Body   []byte
+    Info   NodeInfo
+    Origin *LogOrigin // 写入请求的来源，只在转发给leader的写入请求中存在
 }
 
 // 绑定本地IP并创建一个服务节点
@@ -214,13 +719,24 @@ func NewServer() *Node {
         RaftRole            : gROLE_RAFT_FOLLOWER,
         Leader              : nil,
         MinNode             : 2,
+        Election            : gELECTION_MODE_SCORE,
         AutoScan            : true,
+        LogCompact          : true,
+        LogRetain           : gLOG_COMPACT_RETAIN,
         Peers               : gmap.NewStringInterfaceMap(),
+        Voters              : gmap.NewStringInterfaceMap(),
+        HeartbeatAcks       : gmap.NewStringInterfaceMap(),
         SavePath            : gfile.SelfDir(),
         LogList             : glist.NewSafeList(),
         ServiceList         : glist.NewSafeList(),
         Service             : gmap.NewStringInterfaceMap(),
         DataMap             : gmap.NewStringStringMap(),
+        DataMeta            : gmap.NewStringInterfaceMap(),
+        DataExpire          : gmap.NewStringInterfaceMap(),
+        Sessions            : gmap.NewStringInterfaceMap(),
+        SessionDeadline     : gmap.NewStringInterfaceMap(),
+        Locks               : gmap.NewStringInterfaceMap(),
+        Watchers            : gmap.NewStringInterfaceMap(),
     }
     ips, err := gipv4.IntranetIP()
     if err == nil && len(ips) == 1 {
@@ -235,6 +751,13 @@ func NewServer() *Node {
     gconsole.BindHandle("getkv",      cmd_getkv)
     gconsole.BindHandle("addkv",      cmd_addkv)
     gconsole.BindHandle("delkv",      cmd_delkv)
+    gconsole.BindHandle("kv",         cmd_kv)
+    gconsole.BindHandle("watch",      cmd_watch)
+    gconsole.BindHandle("history",    cmd_history)
+    gconsole.BindHandle("audit",      cmd_audit)
+    gconsole.BindHandle("monitor",    cmd_monitor)
+    gconsole.BindHandle("transfer-leader", cmd_transfer_leader)
+    gconsole.BindHandle("render",     cmd_render)
     gconsole.BindHandle("services",   cmd_services)
     gconsole.BindHandle("getservice", cmd_getservice)
     gconsole.BindHandle("addservice", cmd_addservice)
@@ -333,6 +856,7 @@ func roleName(role int32) string {
         case gROLE_CLIENT:  return "client"
         case gROLE_SERVER:  return "server"
         case gROLE_MONITOR: return "monitor"
+        case gROLE_WITNESS: return "witness"
     }
     return "unknown"
 }
@@ -346,3 +870,11 @@ func raftRoleName(role int32) string {
     }
     return "unknown"
 }
+
+// 判断字符串参数是否表示为真(用于命令行及API的开关参数)
+func isTrueString(s string) bool {
+    switch strings.ToLower(strings.TrimSpace(s)) {
+        case "1", "true", "yes", "on": return true
+    }
+    return false
+}
@@ -1,8 +1,11 @@
 package dister
 
 import (
+    "os"
     "strings"
     "fmt"
+    "time"
+    "net/url"
     "encoding/json"
     "strconv"
     "gitee.com/johng/gf/g/os/gfile"
@@ -20,12 +23,21 @@ func cmd_help () {
     fmt.Printf("Commands : \n")
     fmt.Printf("    ?,help                      : this help\n")
     fmt.Printf("    nodes                       : show all nodes of this group\n")
-    fmt.Printf("    kvs                         : show all key-value sets\n")
+    fmt.Printf("    kvs                         : show all key-value sets, use --prefix=PREFIX to show keys with the prefix\n")
     fmt.Printf("    services                    : show all services\n")
-    fmt.Printf("    addnode    IP/DOMAIN        : add ip/domain to this group\n")
-    fmt.Printf("    delnode    IP/DOMAIN,...    : remove ip/domain from this group, multiple ips/domains seperated by ','\n")
-    fmt.Printf("    addkv      KEY VALUE        : add key-value set to this group\n")
+    fmt.Printf("    addnode    IP/DOMAIN        : add ip/domain to this group, server nodes join as voters one at a time\n")
+    fmt.Printf("    delnode    NODE,...         : remove node(id/name/ip) from this group, multiple nodes seperated by ','\n")
+    fmt.Printf("    transfer-leader [NODE]      : transfer leadership to the node(id/name/ip), or the most up-to-date node if not given\n")
+    fmt.Printf("    getkv      KEY              : show value of the key, use -v to show its revision metadata, --consistency=consistent for linearizable read\n")
+    fmt.Printf("    addkv      KEY VALUE        : add key-value set to this group, use --ttl=SECONDS to expire it automatically\n")
     fmt.Printf("    delkv      KEY,...          : remove keys from this group, multiple keys seperated by ','\n")
+    fmt.Printf("    kv export                   : export key-value sets, use --prefix=PREFIX, --format=json/yaml/properties/env, --file=FILE\n")
+    fmt.Printf("    kv import  FILE             : import key-value sets from file, use --format=FORMAT, --prefix=PREFIX, --dry-run to show diff only\n")
+    fmt.Printf("    watch      KEY              : watch and print changes of the key, use --prefix=true to watch keys with the prefix\n")
+    fmt.Printf("    history    KEY              : show change history of the key, use --at=LOGID to show changes up to the log id\n")
+    fmt.Printf("    audit                       : show write audit trail, use --key=KEY, --prefix=true, --since=TIME, --limit=NUMBER to filter\n")
+    fmt.Printf("    monitor                     : show cluster events recorded by monitor node, use --type=TYPE, --since=TIME, --limit=NUMBER to filter\n")
+    fmt.Printf("    render     TEMPLATE DEST    : render template to file on data changes, use --command=CMD to reload, --once to render once\n")
     fmt.Printf("    addservice CONFIG           : add service to this group, CONFIG specifies the service config file path\n")
     fmt.Printf("    delservice SERVICE_NAME,... : remove service from this group, multiple service names seperated by ','\n")
     fmt.Printf("\n")
@@ -49,13 +61,13 @@ func cmd_nodes () {
         if err := j.GetToVar("data", &peers); err != nil {
             glog.Error(err)
         } else {
-            fmt.Printf("%12s %25s %25s %15s %12s %12s %10s\n", "Id", "Name", "Group", "Ip", "Type", "Role", "Status")
+            fmt.Printf("%12s %25s %25s %15s %12s %12s %10s %12s %8s\n", "Id", "Name", "Group", "Ip", "Type", "Role", "Status", "Zone", "Priority")
             for _,v := range peers {
                 status := "alive"
                 if v.Status == 0 {
                     status = "dead"
                 }
-                fmt.Printf("%12s %25s %25s %15s %12s %12s %10s\n", v.Id, v.Name, v.Group, v.Ip, roleName(v.Role), raftRoleName(v.RaftRole), status)
+                fmt.Printf("%12s %25s %25s %15s %12s %12s %10s %12s %8d\n", v.Id, v.Name, v.Group, v.Ip, roleName(v.Role), raftRoleName(v.RaftRole), status, v.Zone, v.LeaderPriority)
             }
         }
     }
@@ -91,13 +103,15 @@ func cmd_addnode () {
                     return
                 }
             }
+            printMemberChanges(data)
+            return
         }
     }
     fmt.Println("ok")
 }
 
 // 删除集群节点
-// 使用方式：dister delnode IP1,IP2,IP3,...
+// 使用方式：dister delnode 节点ID/名称/IP,...
 func cmd_delnode () {
     nodes := gconsole.Value.Get(2)
     if nodes != "" {
@@ -126,15 +140,35 @@ func cmd_delnode () {
                     return
                 }
             }
+            printMemberChanges(data)
+            return
         }
     }
     fmt.Println("ok")
 }
 
-// 查看所有kv
-// 使用方式：dister kvs
-func cmd_kvs () {
-    r, e := ghttp.Get(fmt.Sprintf("http://127.0.0.1:%d/kv", gPORT_API))
+// 打印节点变更结果，投票成员变更时显示变更提交的logid
+func printMemberChanges(data *gjson.Json) {
+    changes := make([]MemberChange, 0)
+    if err := data.GetToVar("data", &changes); err != nil {
+        glog.Error(err)
+        return
+    }
+    fmt.Printf("%12s %25s %15s %12s  %s\n", "Id", "Name", "Ip", "LogId", "Result")
+    for _, v := range changes {
+        logid := "-"
+        if v.LogId > 0 {
+            logid = fmt.Sprintf("%d", v.LogId)
+        }
+        fmt.Printf("%12s %25s %15s %12s  %s\n", v.Id, v.Name, v.Ip, logid, v.Result)
+    }
+}
+
+// leader转移
+// 使用方式：dister transfer-leader [节点ID/名称/IP]
+func cmd_transfer_leader () {
+    query := fmt.Sprintf("node=%s", url.QueryEscape(gconsole.Value.Get(2)))
+    r, e  := ghttp.Post(fmt.Sprintf("http://127.0.0.1:%d/leader?%s", gPORT_API, query), "")
     if e != nil {
         glog.Error("ERROR: connect to local dister api failed,", e.Error())
         return
@@ -146,24 +180,64 @@ func cmd_kvs () {
         return
     }
     if data.GetInt("result") != 1 {
-        glog.Error("ERROR: " + data.GetString("message"))
+        fmt.Println(data.GetString("message"))
+        return
+    }
+    var info NodeInfo
+    if err := data.GetToVar("data", &info); err != nil {
+        glog.Error(err)
         return
     }
-    m := data.GetMap("data")
-    if len(m) > 0 {
+    fmt.Printf("leadership transferred to %s(%s)\n", info.Name, info.Ip)
+}
+
+// 查看所有kv，按照键名升序分页获取
+// 使用方式：dister kvs [--prefix=键名前缀]
+func cmd_kvs () {
+    prefix := gconsole.Option.Get("prefix")
+    cursor := ""
+    list   := make([]KvItem, 0)
+    for {
+        r, e := ghttp.Get(fmt.Sprintf("http://127.0.0.1:%d/kv?prefix=%s&cursor=%s&limit=%d", gPORT_API, url.QueryEscape(prefix), url.QueryEscape(cursor), gKV_LIST_LIMIT_MAX))
+        if e != nil {
+            glog.Error("ERROR: connect to local dister api failed,", e.Error())
+            return
+        }
+        data, err := gjson.DecodeToJson(r.ReadAll())
+        r.Close()
+        if err != nil {
+            glog.Error(err)
+            return
+        }
+        if data.GetInt("result") != 1 {
+            glog.Error("ERROR: " + data.GetString("message"))
+            return
+        }
+        var result KvList
+        if err := data.GetToVar("data", &result); err != nil {
+            glog.Error(err)
+            return
+        }
+        list = append(list, result.List...)
+        if result.Next == "" {
+            break
+        }
+        cursor = result.Next
+    }
+    if len(list) > 0 {
         // 自动计算key的宽度
         length := 0
-        for k, _ := range m {
-            if len(k) > length {
-                length = len(k)
+        for _, v := range list {
+            if len(v.Key) > length {
+                length = len(v.Key)
             }
         }
         lenstr := strconv.Itoa(length)
         format1 := "%-" + lenstr + "s : %s\n"
         format2 := "%-" + lenstr + "s : %.100s\n"
         fmt.Printf(format1, "K", "V")
-        for k, v := range m {
-            fmt.Printf(format2, k, v)
+        for _, v := range list {
+            fmt.Printf(format2, v.Key, v.Value)
         }
     } else {
         fmt.Println("it's empty")
@@ -171,11 +245,12 @@ func cmd_kvs () {
 }
 
 
-// 查询kv
-// 使用方式：dister getkv 键名
+// 查询kv，给定-v参数时同时显示键值的元数据，给定--consistency参数时指定读取一致性级别
+// 使用方式：dister getkv 键名 [-v] [--consistency=stale/default/consistent]
 func cmd_getkv () {
-    k    := gconsole.Value.Get(2)
-    r, e := ghttp.Get(fmt.Sprintf("http://127.0.0.1:%d/kv?k=%s", gPORT_API, k))
+    k       := gconsole.Value.Get(2)
+    verbose := hasCmdFlag("-v", "--verbose")
+    r, e    := ghttp.Get(fmt.Sprintf("http://127.0.0.1:%d/kv?k=%s&meta=%v&consistency=%s", gPORT_API, url.QueryEscape(k), verbose, url.QueryEscape(gconsole.Option.Get("consistency"))))
     if e != nil {
         glog.Error("ERROR: connect to local dister api failed,", e.Error())
         return
@@ -191,17 +266,62 @@ func cmd_getkv () {
             return
         }
     }
+    if verbose {
+        var detail KvDetail
+        if err := data.GetToVar("data", &detail); err != nil {
+            glog.Error(err)
+            return
+        }
+        fmt.Printf("%-8s: %s\n", "key",     detail.Key)
+        fmt.Printf("%-8s: %s\n", "value",   detail.Value)
+        fmt.Printf("%-8s: %d\n", "create",  detail.CreateId)
+        fmt.Printf("%-8s: %d\n", "modify",  detail.ModifyId)
+        fmt.Printf("%-8s: %d\n", "version", detail.Version)
+        if detail.Ttl > 0 {
+            fmt.Printf("%-8s: %d\n", "ttl", detail.Ttl)
+        }
+        if detail.Session != "" {
+            fmt.Printf("%-8s: %s\n", "session", detail.Session)
+        }
+        return
+    }
     fmt.Println(data.GetString("data"))
 }
 
+// 判断命令行中是否给定了指定的开关参数(如：-v)
+func hasCmdFlag(names ...string) bool {
+    for _, arg := range os.Args {
+        for _, name := range names {
+            if arg == name {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// 获取命令行选项的值，同时支持"--name=value"以及"--name value"两种形式
+func getCmdOption(name string) string {
+    if v := gconsole.Option.Get(name); v != "" {
+        return v
+    }
+    for i := 1; i < len(os.Args) - 1; i++ {
+        if os.Args[i] == "--" + name {
+            return os.Args[i + 1]
+        }
+    }
+    return ""
+}
+
 // 设置kv
-// 使用方式：dister addkv 键名 键值
+// 使用方式：dister addkv 键名 键值 [--ttl=生存时间(秒)]
 func cmd_addkv () {
-    k := gconsole.Value.Get(2)
-    v := gconsole.Value.Get(3)
+    k   := gconsole.Value.Get(2)
+    v   := gconsole.Value.Get(3)
+    ttl := gconsole.Option.GetInt("ttl")
     if k != "" && v != ""{
         b, _ := gjson.Encode(map[string]string{k: v})
-        r, e := ghttp.Request("post", fmt.Sprintf("http://127.0.0.1:%d/kv", gPORT_API), b)
+        r, e := ghttp.Request("post", fmt.Sprintf("http://127.0.0.1:%d/kv?ttl=%d", gPORT_API, ttl), b)
         if e != nil {
             glog.Error("ERROR: connect to local dister api failed,", e.Error())
             return
@@ -221,6 +341,98 @@ func cmd_addkv () {
     fmt.Println("ok")
 }
 
+// kv批量导入导出
+// 使用方式：
+// dister kv export [--prefix=键名前缀] [--format=json/yaml/properties/env] [--file=导出文件路径]
+// dister kv import 文件路径 [--format=json/yaml/properties/env] [--prefix=键名前缀] [--dry-run]
+func cmd_kv () {
+    switch gconsole.Value.Get(2) {
+        case "export": cmd_kv_export()
+        case "import": cmd_kv_import()
+        default:
+            fmt.Println("please specify the sub command: export or import")
+    }
+}
+
+// kv导出，不给定--file时输出到标准输出，不给定--format时根据文件名后缀判断格式
+func cmd_kv_export () {
+    file   := gconsole.Option.Get("file")
+    format := gconsole.Option.Get("format")
+    if format == "" && file != "" {
+        format = getKvFormatByFileName(file)
+    }
+    r, e := ghttp.Get(fmt.Sprintf("http://127.0.0.1:%d/export?prefix=%s&format=%s", gPORT_API, url.QueryEscape(gconsole.Option.Get("prefix")), url.QueryEscape(format)))
+    if e != nil {
+        glog.Error("ERROR: connect to local dister api failed,", e.Error())
+        return
+    }
+    defer r.Close()
+    data, err := gjson.DecodeToJson(r.ReadAll())
+    if err != nil {
+        glog.Error(err)
+        return
+    }
+    if data.GetInt("result") != 1 {
+        fmt.Println(data.GetString("message"))
+        return
+    }
+    if file == "" {
+        fmt.Print(data.GetString("data"))
+        return
+    }
+    if err := gfile.PutContents(file, data.GetString("data")); err != nil {
+        glog.Error(err)
+        return
+    }
+    fmt.Println("ok")
+}
+
+// kv导入，给定--dry-run时只显示差异
+func cmd_kv_import () {
+    file := gconsole.Value.Get(3)
+    if file == "" || !gfile.Exists(file) {
+        fmt.Println("please specify an existing file to import")
+        return
+    }
+    format := gconsole.Option.Get("format")
+    if format == "" {
+        format = getKvFormatByFileName(file)
+    }
+    dryrun := hasCmdFlag("--dry-run") || gconsole.Option.GetBool("dry-run")
+    r, e   := ghttp.Request("post", fmt.Sprintf("http://127.0.0.1:%d/import?format=%s&prefix=%s&dryrun=%v", gPORT_API, url.QueryEscape(format), url.QueryEscape(gconsole.Option.Get("prefix")), dryrun), gfile.GetBinContents(file))
+    if e != nil {
+        glog.Error("ERROR: connect to local dister api failed,", e.Error())
+        return
+    }
+    defer r.Close()
+    data, err := gjson.DecodeToJson(r.ReadAll())
+    if err != nil {
+        glog.Error(err)
+        return
+    }
+    if data.GetInt("result") != 1 {
+        fmt.Println(data.GetString("message"))
+        return
+    }
+    var result KvImportResult
+    if err := data.GetToVar("data", &result); err != nil {
+        glog.Error(err)
+        return
+    }
+    for _, k := range result.Added {
+        fmt.Printf("+ %s\n", k)
+    }
+    for _, v := range result.Changed {
+        fmt.Printf("~ %s : %s => %s\n", v.Key, v.Old, v.New)
+    }
+    fmt.Printf("added: %d, changed: %d, unchanged: %d\n", len(result.Added), len(result.Changed), result.Unchanged)
+    if dryrun {
+        fmt.Println("dry run, nothing written")
+    } else {
+        fmt.Printf("written logids: %v\n", result.LogIds)
+    }
+}
+
 // 删除
 // 使用方式：dister delkv 键名1,键名2,键名3,...
 func cmd_delkv () {
@@ -256,6 +468,207 @@ func cmd_delkv () {
     fmt.Println("ok")
 }
 
+// 监听kv变化，持续输出键值的变化事件，直到手动终止
+// 使用方式：dister watch 键名 [--prefix=true]
+func cmd_watch () {
+    k      := gconsole.Value.Get(2)
+    prefix := gconsole.Option.GetBool("prefix")
+    if k == "" && !prefix {
+        fmt.Println("please specify the key to watch")
+        return
+    }
+    var logid int64
+    for {
+        r, e := ghttp.Get(fmt.Sprintf("http://127.0.0.1:%d/watch?k=%s&prefix=%v&logid=%d", gPORT_API, url.QueryEscape(k), prefix, logid))
+        if e != nil {
+            glog.Error("ERROR: connect to local dister api failed,", e.Error())
+            return
+        }
+        data, err := gjson.DecodeToJson(r.ReadAll())
+        r.Close()
+        if err != nil {
+            glog.Error(err)
+            return
+        }
+        if data.GetInt("result") != 1 {
+            // 可能是leader选举中，稍后重试
+            fmt.Println(data.GetString("message"))
+            time.Sleep(time.Second)
+            continue
+        }
+        var result WatchResult
+        if err := data.GetToVar("data", &result); err != nil {
+            glog.Error(err)
+            return
+        }
+        if result.Compacted > 0 {
+            fmt.Printf("changes before logid %d have been compacted, please re-read the current data\n", result.Compacted)
+        }
+        for _, v := range result.Events {
+            if v.Act == "remove" {
+                fmt.Printf("%d %-6s %s\n", v.Id, v.Act, v.Key)
+            } else {
+                fmt.Printf("%d %-6s %s : %s\n", v.Id, v.Act, v.Key, v.Value)
+            }
+        }
+        logid = result.LogId
+    }
+}
+
+// 查看kv的变化历史，按照logid升序输出
+// 使用方式：dister history 键名 [--at=logid]
+func cmd_history () {
+    k := gconsole.Value.Get(2)
+    if k == "" {
+        fmt.Println("please specify the key to show history")
+        return
+    }
+    r, e := ghttp.Get(fmt.Sprintf("http://127.0.0.1:%d/history?k=%s&at=%s", gPORT_API, url.QueryEscape(k), url.QueryEscape(gconsole.Option.Get("at"))))
+    if e != nil {
+        glog.Error("ERROR: connect to local dister api failed,", e.Error())
+        return
+    }
+    defer r.Close()
+    data, err := gjson.DecodeToJson(r.ReadAll())
+    if err != nil {
+        glog.Error(err)
+        return
+    }
+    if data.GetInt("result") != 1 {
+        fmt.Println(data.GetString("message"))
+        return
+    }
+    var history KvHistory
+    if err := data.GetToVar("data", &history); err != nil {
+        glog.Error(err)
+        return
+    }
+    if history.Compacted > 0 {
+        fmt.Printf("changes before logid %d have been compacted\n", history.Compacted)
+    }
+    if len(history.Events) == 0 {
+        fmt.Println("no history found")
+        return
+    }
+    for _, v := range history.Events {
+        if v.Act == "remove" {
+            fmt.Printf("%d %-6s %s\n", v.Id, v.Act, v.Key)
+        } else {
+            fmt.Printf("%d %-6s %s : %s\n", v.Id, v.Act, v.Key, v.Value)
+        }
+    }
+}
+
+// 查看写入审计记录
+// 使用方式：dister audit [--key 键名] [--prefix=true] [--since 时间] [--limit 数量]
+func cmd_audit () {
+    query := fmt.Sprintf("k=%s&prefix=%s&since=%s&limit=%s",
+        url.QueryEscape(getCmdOption("key")),
+        url.QueryEscape(getCmdOption("prefix")),
+        url.QueryEscape(getCmdOption("since")),
+        url.QueryEscape(getCmdOption("limit")),
+    )
+    r, e := ghttp.Get(fmt.Sprintf("http://127.0.0.1:%d/audit?%s", gPORT_API, query))
+    if e != nil {
+        glog.Error("ERROR: connect to local dister api failed,", e.Error())
+        return
+    }
+    defer r.Close()
+    data, err := gjson.DecodeToJson(r.ReadAll())
+    if err != nil {
+        glog.Error(err)
+        return
+    }
+    if data.GetInt("result") != 1 {
+        fmt.Println(data.GetString("message"))
+        return
+    }
+    var result AuditResult
+    if err := data.GetToVar("data", &result); err != nil {
+        glog.Error(err)
+        return
+    }
+    if result.Compacted > 0 {
+        fmt.Printf("writes before logid %d have been compacted\n", result.Compacted)
+    }
+    if len(result.Records) == 0 {
+        fmt.Println("no audit records found")
+        return
+    }
+    for _, v := range result.Records {
+        if v.Origin == nil {
+            fmt.Printf("%d %-15s %s\n", v.Id, v.Act, "-")
+        } else {
+            fmt.Printf("%d %-15s %s node:%s(%s) ip:%s remote:%s user:%s reason:%s\n",
+                v.Id, v.Act,
+                time.Unix(0, v.Origin.Time*int64(time.Millisecond)).Format("2006-01-02 15:04:05"),
+                v.Origin.Node, v.Origin.Name, v.Origin.Ip, v.Origin.Remote, v.Origin.User, v.Origin.Reason,
+            )
+        }
+        for _, e := range v.Events {
+            if e.Act == "remove" {
+                fmt.Printf("    %-6s %s\n", e.Act, e.Key)
+            } else {
+                fmt.Printf("    %-6s %s : %s\n", e.Act, e.Key, e.Value)
+            }
+        }
+    }
+}
+
+// 查看monitor节点记录的集群监控事件
+// 使用方式：dister monitor [--type leader/peer/lag/service] [--since 时间] [--limit 数量]
+func cmd_monitor () {
+    query := fmt.Sprintf("type=%s&since=%s&limit=%s",
+        url.QueryEscape(getCmdOption("type")),
+        url.QueryEscape(getCmdOption("since")),
+        url.QueryEscape(getCmdOption("limit")),
+    )
+    r, e := ghttp.Get(fmt.Sprintf("http://127.0.0.1:%d/monitor?%s", gPORT_API, query))
+    if e != nil {
+        glog.Error("ERROR: connect to local dister api failed,", e.Error())
+        return
+    }
+    defer r.Close()
+    data, err := gjson.DecodeToJson(r.ReadAll())
+    if err != nil {
+        glog.Error(err)
+        return
+    }
+    if data.GetInt("result") != 1 {
+        fmt.Println(data.GetString("message"))
+        return
+    }
+    var report MonitorReport
+    if err := data.GetToVar("data", &report); err != nil {
+        glog.Error(err)
+        return
+    }
+    if v := report.Status; v != nil {
+        leader := v.Leader
+        if leader == "" {
+            leader = "-"
+        }
+        fmt.Printf("leader:%s term:%d logid:%d commitid:%d alive:%d/%d\n", leader, v.Term, v.LastLogId, v.CommitLogId, v.Alive, v.Total)
+        for name, lag := range v.Lags {
+            fmt.Printf("    %-25s lag:%d\n", name, lag)
+        }
+    }
+    if len(report.Events) == 0 {
+        fmt.Println("no monitor events found")
+        return
+    }
+    for _, v := range report.Events {
+        from := v.From
+        if from == "" {
+            from = "-"
+        }
+        fmt.Printf("%s %-8s %-25s %s -> %s %s\n",
+            time.Unix(0, v.Time*int64(time.Millisecond)).Format("2006-01-02 15:04:05"),
+            v.Type, v.Node, from, v.To, v.Detail,
+        )
+    }
+}
+
 // 查看所有Service
 // 使用方式：dister services
 func cmd_services () {
@@ -0,0 +1,294 @@
+// 配置文件模板渲染(render)
+// 根据模板文件中引用的KV键值以及健康的服务节点渲染生成配置文件，并持续监听KV数据变化以及定期检查服务节点变化，
+// 当渲染结果发生变化时原子性地替换目标文件，并执行给定的重载命令，一般运行在client节点上
+// 模板使用text/template语法，支持的函数：
+// key "键名"                   : 获取键值，键名不存在时渲染失败
+// keyOrDefault "键名" "默认值" : 获取键值，键名不存在时使用默认值
+// ls "键名前缀"                : 获取指定前缀的键值列表(按照键名升序)，列表项包含Key、Value字段
+// service "服务名称"           : 获取服务健康的节点列表，节点为服务配置中的节点信息(map)
+package dister
+
+import (
+    "os"
+    "fmt"
+    "time"
+    "bytes"
+    "errors"
+    "os/exec"
+    "net/url"
+    "runtime"
+    "text/template"
+    "path/filepath"
+    "gitee.com/johng/gf/g/os/glog"
+    "gitee.com/johng/gf/g/os/gfile"
+    "gitee.com/johng/gf/g/net/ghttp"
+    "gitee.com/johng/gf/g/os/gconsole"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+const (
+    gRENDER_SERVICE_INTERVAL = 5 // (秒)默认的服务节点变化检查间隔
+)
+
+// 模板渲染
+// 使用方式：dister render 模板文件路径 目标文件路径 [--command=重载命令] [--interval=服务检查间隔(秒)] [--once]
+func cmd_render () {
+    tpl  := gconsole.Value.Get(2)
+    dest := gconsole.Value.Get(3)
+    if tpl == "" || dest == "" {
+        fmt.Println("please specify the template file and the destination file")
+        return
+    }
+    if !gfile.Exists(tpl) {
+        fmt.Println("template file does not exist:", tpl)
+        return
+    }
+    once     := hasCmdFlag("--once") || gconsole.Option.GetBool("once")
+    command  := gconsole.Option.Get("command")
+    interval := gconsole.Option.GetInt("interval")
+    if interval <= 0 {
+        interval = gRENDER_SERVICE_INTERVAL
+    }
+    // 重载命令执行失败时标记为待重载，下一次渲染时即使内容没有变化也会重新执行
+    pending, err := renderTemplateToFile(tpl, dest, command, false)
+    if err != nil {
+        glog.Error(err)
+    }
+    if once {
+        return
+    }
+    // KV数据变化通过监听获得，服务节点变化通过定期检查获得
+    changes := make(chan struct{}, 1)
+    go watchAllDataChanges(changes)
+    ticker := time.NewTicker(time.Duration(interval) * time.Second)
+    defer ticker.Stop()
+    for {
+        select {
+            case <- changes:
+            case <- ticker.C:
+        }
+        if pending, err = renderTemplateToFile(tpl, dest, command, pending); err != nil {
+            glog.Error(err)
+        }
+    }
+}
+
+// 渲染模板，当渲染结果与目标文件内容不同时替换目标文件并执行重载命令，
+// pending表示上一次的重载命令执行失败，此时即使内容没有变化也需要重新执行重载命令；
+// 返回重载命令是否仍然待执行
+func renderTemplateToFile(tpl string, dest string, command string, pending bool) (bool, error) {
+    if command == "" {
+        pending = false
+    }
+    content, err := renderTemplate(tpl)
+    if err != nil {
+        return pending, err
+    }
+    if !gfile.Exists(dest) || !bytes.Equal(gfile.GetBinContents(dest), content) {
+        if err := writeFileAtomically(dest, content); err != nil {
+            return pending, err
+        }
+        glog.Printfln("rendered %s to %s", tpl, dest)
+        pending = command != ""
+    }
+    if pending {
+        if output, err := runShellCommand(command); err != nil {
+            return true, errors.New(fmt.Sprintf("reload command failed: %s, output: %s", err.Error(), output))
+        }
+    }
+    return false, nil
+}
+
+// 执行模板渲染
+func renderTemplate(path string) ([]byte, error) {
+    t, err := template.New(filepath.Base(path)).Funcs(template.FuncMap {
+        "key"          : renderFuncKey,
+        "keyOrDefault" : renderFuncKeyOrDefault,
+        "ls"           : renderFuncLs,
+        "service"      : renderFuncService,
+    }).Parse(gfile.GetContents(path))
+    if err != nil {
+        return nil, err
+    }
+    buffer := bytes.NewBuffer(nil)
+    if err := t.Execute(buffer, nil); err != nil {
+        return nil, err
+    }
+    return buffer.Bytes(), nil
+}
+
+// 模板函数：获取键值，键名不存在时返回错误
+func renderFuncKey(k string) (string, error) {
+    v, ok, err := getRenderData(k)
+    if err != nil {
+        return "", err
+    }
+    if !ok {
+        return "", errors.New("key not found: " + k)
+    }
+    return v, nil
+}
+
+// 模板函数：获取键值，键名不存在时返回默认值
+func renderFuncKeyOrDefault(k string, def string) (string, error) {
+    v, ok, err := getRenderData(k)
+    if err != nil {
+        return "", err
+    }
+    if !ok {
+        return def, nil
+    }
+    return v, nil
+}
+
+// 模板函数：获取指定前缀的键值列表
+func renderFuncLs(prefix string) ([]KvItem, error) {
+    list   := make([]KvItem, 0)
+    cursor := ""
+    for {
+        data, err := getLocalApiData(fmt.Sprintf("/kv?prefix=%s&cursor=%s&limit=%d", url.QueryEscape(prefix), url.QueryEscape(cursor), gKV_LIST_LIMIT_MAX))
+        if err != nil {
+            return nil, err
+        }
+        var result KvList
+        if err := data.GetToVar("data", &result); err != nil {
+            return nil, err
+        }
+        list = append(list, result.List...)
+        if result.Next == "" {
+            break
+        }
+        cursor = result.Next
+    }
+    return list, nil
+}
+
+// 模板函数：获取服务健康的节点列表
+func renderFuncService(name string) ([]map[string]interface{}, error) {
+    data, err := getLocalApiData(fmt.Sprintf("/service?name=%s", url.QueryEscape(name)))
+    if err != nil {
+        return nil, err
+    }
+    var sc ServiceConfig
+    if err := data.GetToVar("data", &sc); err != nil {
+        return nil, err
+    }
+    list := make([]map[string]interface{}, 0)
+    for _, v := range sc.Node {
+        if status, ok := v["status"]; ok && fmt.Sprintf("%v", status) == "1" {
+            list = append(list, v)
+        }
+    }
+    return list, nil
+}
+
+// 通过本地API获取键值，返回键值、是否存在以及错误信息
+func getRenderData(k string) (string, bool, error) {
+    r, e := ghttp.Get(fmt.Sprintf("http://127.0.0.1:%d/kv?k=%s&meta=1", gPORT_API, url.QueryEscape(k)))
+    if e != nil {
+        return "", false, errors.New("connect to local dister api failed, " + e.Error())
+    }
+    defer r.Close()
+    data, err := gjson.DecodeToJson(r.ReadAll())
+    if err != nil {
+        return "", false, err
+    }
+    // 键值查询失败时无法区分是否是键名不存在，因此通过元数据查询的返回码判断
+    switch data.GetInt("result") {
+        case 1:
+        case gAPI_RESULT_NOT_FOUND:
+            return "", false, nil
+        default:
+            return "", false, errors.New(data.GetString("message"))
+    }
+    var detail KvDetail
+    if err := data.GetToVar("data", &detail); err != nil {
+        return "", false, err
+    }
+    return detail.Value, true, nil
+}
+
+// 通过本地API获取数据，请求失败时返回错误
+func getLocalApiData(path string) (*gjson.Json, error) {
+    r, e := ghttp.Get(fmt.Sprintf("http://127.0.0.1:%d%s", gPORT_API, path))
+    if e != nil {
+        return nil, errors.New("connect to local dister api failed, " + e.Error())
+    }
+    defer r.Close()
+    data, err := gjson.DecodeToJson(r.ReadAll())
+    if err != nil {
+        return nil, err
+    }
+    if data.GetInt("result") != 1 {
+        return nil, errors.New(data.GetString("message"))
+    }
+    return data, nil
+}
+
+// 持续监听所有KV数据的变化，有变化时通知渲染
+func watchAllDataChanges(changes chan struct{}) {
+    var logid int64
+    for {
+        data, err := getLocalApiData(fmt.Sprintf("/watch?prefix=true&logid=%d", logid))
+        if err != nil {
+            // 可能是leader选举中，稍后重试
+            glog.Error(err)
+            time.Sleep(time.Second)
+            continue
+        }
+        var result WatchResult
+        if err := data.GetToVar("data", &result); err != nil {
+            glog.Error(err)
+            time.Sleep(time.Second)
+            continue
+        }
+        // 监听的logid已被日志压缩时中间的变化无法获得，同样需要重新渲染
+        if len(result.Events) > 0 || result.Compacted > 0 {
+            select {
+                case changes <- struct{}{}:
+                default:
+            }
+        }
+        logid = result.LogId
+    }
+}
+
+// 原子性写入文件：先写入同一目录下的临时文件，再重命名为目标文件，并保留目标文件原有的权限
+func writeFileAtomically(path string, content []byte) error {
+    mode := os.FileMode(0644)
+    if info, err := os.Stat(path); err == nil {
+        mode = info.Mode()
+    }
+    temp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.dister.tmp", filepath.Base(path)))
+    file, err := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+    if err != nil {
+        return err
+    }
+    if _, err := file.Write(content); err != nil {
+        file.Close()
+        os.Remove(temp)
+        return err
+    }
+    if err := file.Sync(); err != nil {
+        file.Close()
+        os.Remove(temp)
+        return err
+    }
+    if err := file.Close(); err != nil {
+        os.Remove(temp)
+        return err
+    }
+    if err := os.Rename(temp, path); err != nil {
+        os.Remove(temp)
+        return err
+    }
+    return nil
+}
+
+// 执行shell命令，返回命令输出
+func runShellCommand(command string) ([]byte, error) {
+    if runtime.GOOS == "windows" {
+        return exec.Command("cmd", "/C", command).CombinedOutput()
+    }
+    return exec.Command("sh", "-c", command).CombinedOutput()
+}
@@ -0,0 +1,395 @@
+// KV数据的导入导出格式
+// 支持的格式：json(平铺的键值对象)、yaml(平铺的键值映射，不支持嵌套结构)、properties(Java属性文件)、env(dotenv文件)，
+// 导出时键名按照字典序升序排列；环境变量名称不能包含'/'，env格式导出时键名中的'/'映射为"__"，导入时再映射回'/'。
+package dister
+
+import (
+    "fmt"
+    "sort"
+    "bufio"
+    "bytes"
+    "errors"
+    "strings"
+    "strconv"
+    "path/filepath"
+    "encoding/json"
+)
+
+const (
+    gKV_FORMAT_JSON       = "json"
+    gKV_FORMAT_YAML       = "yaml"
+    gKV_FORMAT_PROPERTIES = "properties"
+    gKV_FORMAT_ENV        = "env"
+)
+
+// 根据文件名后缀判断数据格式，无法判断时返回json
+func getKvFormatByFileName(name string) string {
+    switch strings.ToLower(filepath.Ext(name)) {
+        case ".yaml", ".yml": return gKV_FORMAT_YAML
+        case ".properties":   return gKV_FORMAT_PROPERTIES
+        case ".env":          return gKV_FORMAT_ENV
+    }
+    if strings.ToLower(filepath.Base(name)) == ".env" {
+        return gKV_FORMAT_ENV
+    }
+    return gKV_FORMAT_JSON
+}
+
+// 检查数据格式是否支持，为空时使用json
+func checkKvFormat(format string) (string, error) {
+    switch format {
+        case "":
+            return gKV_FORMAT_JSON, nil
+        case gKV_FORMAT_JSON, gKV_FORMAT_YAML, gKV_FORMAT_PROPERTIES, gKV_FORMAT_ENV:
+            return format, nil
+        case "yml":
+            return gKV_FORMAT_YAML, nil
+        case "dotenv":
+            return gKV_FORMAT_ENV, nil
+    }
+    return "", errors.New("invalid format: " + format + ", should be json, yaml, properties or env")
+}
+
+// 将键值对编码为指定格式的内容
+func encodeKvFormat(format string, m map[string]string) ([]byte, error) {
+    keys := make([]string, 0, len(m))
+    for k, _ := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    buffer := bytes.NewBuffer(nil)
+    switch format {
+        case gKV_FORMAT_JSON:
+            b, err := json.MarshalIndent(m, "", "    ")
+            if err != nil {
+                return nil, err
+            }
+            buffer.Write(b)
+            buffer.WriteByte('\n')
+
+        case gKV_FORMAT_YAML:
+            for _, k := range keys {
+                buffer.WriteString(fmt.Sprintf("%s: %s\n", strconv.Quote(k), strconv.Quote(m[k])))
+            }
+
+        case gKV_FORMAT_PROPERTIES:
+            for _, k := range keys {
+                buffer.WriteString(fmt.Sprintf("%s=%s\n", escapeProperties(k, true), escapeProperties(m[k], false)))
+            }
+
+        case gKV_FORMAT_ENV:
+            for _, k := range keys {
+                name := encodeEnvKey(k)
+                // 映射之后无法还原的键名(例如本身包含"__"或者与'/'相邻的'_')同样不能导出
+                if !isEnvKey(name) || decodeEnvKey(name) != k {
+                    return nil, errors.New("invalid env variable name: " + k)
+                }
+                buffer.WriteString(fmt.Sprintf("%s=%s\n", name, strconv.Quote(m[k])))
+            }
+
+        default:
+            return nil, errors.New("invalid format: " + format)
+    }
+    return buffer.Bytes(), nil
+}
+
+// 将指定格式的内容解码为键值对
+func decodeKvFormat(format string, content []byte) (map[string]string, error) {
+    switch format {
+        case gKV_FORMAT_JSON:       return decodeKvJson(content)
+        case gKV_FORMAT_YAML:       return decodeKvYaml(content)
+        case gKV_FORMAT_PROPERTIES: return decodeKvProperties(content)
+        case gKV_FORMAT_ENV:        return decodeKvEnv(content)
+    }
+    return nil, errors.New("invalid format: " + format)
+}
+
+// 解析平铺的json对象，非字符串的标量值转换为字符串
+func decodeKvJson(content []byte) (map[string]string, error) {
+    data    := make(map[string]interface{})
+    decoder := json.NewDecoder(bytes.NewReader(content))
+    decoder.UseNumber()
+    if err := decoder.Decode(&data); err != nil {
+        return nil, err
+    }
+    m := make(map[string]string, len(data))
+    for k, v := range data {
+        switch v.(type) {
+            case map[string]interface{}, []interface{}:
+                return nil, errors.New("nested value is not supported, key: " + k)
+            case nil:
+                m[k] = ""
+            default:
+                m[k] = fmt.Sprintf("%v", v)
+        }
+    }
+    return m, nil
+}
+
+// 解析平铺的yaml映射，每行一个"键名: 键值"，支持单双引号以及#注释
+func decodeKvYaml(content []byte) (map[string]string, error) {
+    m       := make(map[string]string)
+    scanner := newKvScanner(content)
+    lineno  := 0
+    for scanner.Scan() {
+        lineno++
+        line := scanner.Text()
+        trim := strings.TrimSpace(line)
+        if trim == "" || trim[0] == '#' || trim == "---" {
+            continue
+        }
+        if line[0] == ' ' || line[0] == '\t' || trim[0] == '-' {
+            return nil, errors.New(fmt.Sprintf("nested yaml is not supported, line: %d", lineno))
+        }
+        key, rest, err := parseYamlScalar(trim, true)
+        if err != nil {
+            return nil, errors.New(fmt.Sprintf("%s, line: %d", err.Error(), lineno))
+        }
+        rest = strings.TrimSpace(rest)
+        if rest == "" || rest[0] != ':' {
+            return nil, errors.New(fmt.Sprintf("missing ':' after key, line: %d", lineno))
+        }
+        value, rest, err := parseYamlScalar(strings.TrimSpace(rest[1:]), false)
+        if err != nil {
+            return nil, errors.New(fmt.Sprintf("%s, line: %d", err.Error(), lineno))
+        }
+        if rest = strings.TrimSpace(rest); rest != "" && rest[0] != '#' {
+            return nil, errors.New(fmt.Sprintf("unexpected content after value, line: %d", lineno))
+        }
+        m[key] = value
+    }
+    return m, scanner.Err()
+}
+
+// 创建按行读取内容的Scanner，单行的长度上限为内容的长度，避免超过默认64KB上限的键值(例如证书)无法导入
+func newKvScanner(content []byte) *bufio.Scanner {
+    scanner := bufio.NewScanner(bytes.NewReader(content))
+    scanner.Buffer(make([]byte, 0, 64*1024), len(content) + 1)
+    return scanner
+}
+
+// 解析yaml的标量(键名或者键值)，返回标量内容以及剩余的内容
+func parseYamlScalar(s string, iskey bool) (string, string, error) {
+    if s == "" {
+        return "", "", nil
+    }
+    switch s[0] {
+        case '"':
+            for i := 1; i < len(s); i++ {
+                if s[i] == '\\' {
+                    i++
+                } else if s[i] == '"' {
+                    v, err := strconv.Unquote(s[:i + 1])
+                    return v, s[i + 1:], err
+                }
+            }
+            return "", "", errors.New("unterminated double-quoted string")
+
+        case '\'':
+            buffer := bytes.NewBuffer(nil)
+            for i := 1; i < len(s); i++ {
+                if s[i] == '\'' {
+                    if i + 1 < len(s) && s[i + 1] == '\'' {
+                        buffer.WriteByte('\'')
+                        i++
+                        continue
+                    }
+                    return buffer.String(), s[i + 1:], nil
+                }
+                buffer.WriteByte(s[i])
+            }
+            return "", "", errors.New("unterminated single-quoted string")
+
+        case '{', '[', '|', '>', '&', '*', '!':
+            return "", "", errors.New("unsupported yaml syntax")
+    }
+    // 普通标量，键名以": "或者结尾的":"结束，键值以" #"注释结束
+    if iskey {
+        if i := strings.Index(s, ": "); i > 0 {
+            return strings.TrimSpace(s[:i]), s[i:], nil
+        }
+        if strings.HasSuffix(s, ":") {
+            return strings.TrimSpace(s[:len(s) - 1]), ":", nil
+        }
+        return "", "", errors.New("missing ':' after key")
+    }
+    if i := strings.Index(s, " #"); i >= 0 {
+        return strings.TrimSpace(s[:i]), s[i:], nil
+    }
+    return strings.TrimSpace(s), "", nil
+}
+
+// 解析Java属性文件，支持=、:以及空白分隔符，支持#和!注释、行尾\续行以及\转义
+func decodeKvProperties(content []byte) (map[string]string, error) {
+    m       := make(map[string]string)
+    scanner := newKvScanner(content)
+    logical := ""
+    for scanner.Scan() {
+        line := strings.TrimLeft(scanner.Text(), " \t\f")
+        if logical == "" && (line == "" || line[0] == '#' || line[0] == '!') {
+            continue
+        }
+        // 行尾奇数个\表示续行
+        count := 0
+        for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+            count++
+        }
+        if count%2 == 1 {
+            logical += line[:len(line) - 1]
+            continue
+        }
+        logical += line
+        k, v := splitProperties(logical)
+        m[unescapeProperties(k)] = unescapeProperties(v)
+        logical = ""
+    }
+    if logical != "" {
+        k, v := splitProperties(logical)
+        m[unescapeProperties(k)] = unescapeProperties(v)
+    }
+    return m, scanner.Err()
+}
+
+// 拆分属性文件的一行为键名和键值(均未反转义)
+func splitProperties(line string) (string, string) {
+    i := 0
+    for ; i < len(line); i++ {
+        c := line[i]
+        if c == '\\' {
+            i++
+            continue
+        }
+        if c == '=' || c == ':' || c == ' ' || c == '\t' || c == '\f' {
+            break
+        }
+    }
+    if i >= len(line) {
+        return line, ""
+    }
+    key  := line[:i]
+    rest := strings.TrimLeft(line[i:], " \t\f")
+    if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+        rest = strings.TrimLeft(rest[1:], " \t\f")
+    }
+    return key, rest
+}
+
+// 属性文件的反转义
+func unescapeProperties(s string) string {
+    if strings.IndexByte(s, '\\') < 0 {
+        return s
+    }
+    buffer := bytes.NewBuffer(nil)
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        if c != '\\' || i + 1 >= len(s) {
+            buffer.WriteByte(c)
+            continue
+        }
+        i++
+        switch s[i] {
+            case 't': buffer.WriteByte('\t')
+            case 'n': buffer.WriteByte('\n')
+            case 'r': buffer.WriteByte('\r')
+            case 'f': buffer.WriteByte('\f')
+            case 'u':
+                if i + 4 < len(s) {
+                    if r, err := strconv.ParseUint(s[i + 1 : i + 5], 16, 32); err == nil {
+                        buffer.WriteRune(rune(r))
+                        i += 4
+                        break
+                    }
+                }
+                buffer.WriteByte('u')
+            default:
+                buffer.WriteByte(s[i])
+        }
+    }
+    return buffer.String()
+}
+
+// 属性文件的转义，键名中的空白及分隔符也需要转义
+func escapeProperties(s string, iskey bool) string {
+    buffer := bytes.NewBuffer(nil)
+    for i, c := range s {
+        switch c {
+            case '\\': buffer.WriteString(`\\`)
+            case '\t': buffer.WriteString(`\t`)
+            case '\n': buffer.WriteString(`\n`)
+            case '\r': buffer.WriteString(`\r`)
+            case '\f': buffer.WriteString(`\f`)
+            case '=', ':', '#', '!':
+                buffer.WriteByte('\\')
+                buffer.WriteRune(c)
+            case ' ':
+                if iskey || i == 0 {
+                    buffer.WriteByte('\\')
+                }
+                buffer.WriteRune(c)
+            default:
+                buffer.WriteRune(c)
+        }
+    }
+    return buffer.String()
+}
+
+// 解析dotenv文件，每行一个"KEY=VALUE"，支持export前缀、单双引号以及#注释
+func decodeKvEnv(content []byte) (map[string]string, error) {
+    m       := make(map[string]string)
+    scanner := newKvScanner(content)
+    lineno  := 0
+    for scanner.Scan() {
+        lineno++
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || line[0] == '#' {
+            continue
+        }
+        line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+        i   := strings.IndexByte(line, '=')
+        if i <= 0 {
+            return nil, errors.New(fmt.Sprintf("missing '=' in env line: %d", lineno))
+        }
+        key   := strings.TrimSpace(line[:i])
+        value := strings.TrimSpace(line[i + 1:])
+        if !isEnvKey(key) {
+            return nil, errors.New(fmt.Sprintf("invalid env variable name: %s, line: %d", key, lineno))
+        }
+        if value != "" && (value[0] == '"' || value[0] == '\'') {
+            v, rest, err := parseYamlScalar(value, false)
+            if err != nil {
+                return nil, errors.New(fmt.Sprintf("%s, line: %d", err.Error(), lineno))
+            }
+            if rest = strings.TrimSpace(rest); rest != "" && rest[0] != '#' {
+                return nil, errors.New(fmt.Sprintf("unexpected content after value, line: %d", lineno))
+            }
+            value = v
+        } else if j := strings.Index(value, " #"); j >= 0 {
+            value = strings.TrimSpace(value[:j])
+        }
+        m[decodeEnvKey(key)] = value
+    }
+    return m, scanner.Err()
+}
+
+// 将键名映射为环境变量名称，'/'映射为"__"
+func encodeEnvKey(k string) string {
+    return strings.Replace(k, "/", "__", -1)
+}
+
+// 将环境变量名称映射回键名，"__"映射为'/'
+func decodeEnvKey(k string) string {
+    return strings.Replace(k, "__", "/", -1)
+}
+
+// 判断是否为合法的环境变量名称
+func isEnvKey(k string) bool {
+    if k == "" || (k[0] >= '0' && k[0] <= '9') {
+        return false
+    }
+    for _, c := range k {
+        if !(c == '_' || c == '.' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,53 @@
+package dister
+
+import (
+    "strings"
+    "testing"
+)
+
+// 各格式导出之后再导入，键值对应当保持不变
+func TestKvFormatRoundTrip(t *testing.T) {
+    long  := strings.Repeat("0123456789abcdef", 8*1024)
+    cases := []struct {
+        format string
+        data   map[string]string
+    } {
+        {gKV_FORMAT_JSON,       map[string]string{"a/b": "1", "empty": "", "中文": "值", "quote": `"x"`, "long": long}},
+        {gKV_FORMAT_YAML,       map[string]string{"a/b": "1", "empty": "", "中文": "值", "k: v": "# not comment", "line": "a\nb\tc", "long": long}},
+        {gKV_FORMAT_PROPERTIES, map[string]string{"a/b": "1", "empty": "", "中文": "值", "k=v": " lead", "k v": "a:b#c!d", "line": "a\nb\\c", "long": long}},
+        {gKV_FORMAT_ENV,        map[string]string{"app/db/host": "127.0.0.1", "EMPTY": "", "a.b-c": "值 #x", "line": "a\nb\"c'", "long": long}},
+    }
+    for k, v := range cases {
+        content, err := encodeKvFormat(v.format, v.data)
+        if err != nil {
+            t.Errorf("case %d: %s encode error: %v", k, v.format, err)
+            continue
+        }
+        m, err := decodeKvFormat(v.format, content)
+        if err != nil {
+            t.Errorf("case %d: %s decode error: %v", k, v.format, err)
+            continue
+        }
+        if len(m) != len(v.data) {
+            t.Errorf("case %d: %s expect %d keys, got %d", k, v.format, len(v.data), len(m))
+        }
+        for key, value := range v.data {
+            if r, ok := m[key]; !ok || r != value {
+                t.Errorf("case %d: %s key %q mismatch", k, v.format, key)
+            }
+        }
+    }
+}
+
+// env格式中'/'映射为"__"，无法还原或者不合法的键名不能导出
+func TestKvFormatEnvKey(t *testing.T) {
+    content, err := encodeKvFormat(gKV_FORMAT_ENV, map[string]string{"app/db/host": "h"})
+    if err != nil || string(content) != "app__db__host=\"h\"\n" {
+        t.Errorf("unexpected env content: %q, %v", content, err)
+    }
+    for _, k := range []string{"a__b", "a_/b", "1a", "a b", "a=b", ""} {
+        if _, err := encodeKvFormat(gKV_FORMAT_ENV, map[string]string{k: "v"}); err == nil {
+            t.Errorf("key %q should be rejected", k)
+        }
+    }
+}
@@ -43,6 +43,10 @@ func (n *Node) doRecieveMsg(conn net.Conn) *Msg {
     data := Receive(conn)
     if data != nil && len(data) > 0 {
         msg := n.decodeMsg(data)
+        if msg == nil {
+            glog.Errorfln("invalid message from %s, length: %d", conn.RemoteAddr().String(), len(data))
+            return nil
+        }
         if msg.Info.Ip == "127.0.0.1" || msg.Info.Ip == "" {
             ip, _      := gipv4.ParseAddress(conn.RemoteAddr().String())
             msg.Info.Ip = ip
@@ -50,6 +54,10 @@ func (n *Node) doRecieveMsg(conn net.Conn) *Msg {
         // 保存节点信息
         if msg.Info.Id != n.Id {
             n.updatePeerInfo(msg.Info)
+            // 对方任期更高时更新任期并退回follower(例如已被取代的旧leader收到任期过期的回复)
+            n.checkTermFromMsg(msg)
+            // 从leader的消息中获取已提交的logid
+            n.followCommitLogId(msg)
         }
         return msg
     }
@@ -58,25 +66,34 @@ func (n *Node) doRecieveMsg(conn net.Conn) *Msg {
 
 // 发送Msg
 func (n *Node) sendMsg(conn net.Conn, head int, body []byte) error {
+    return n.sendMsgWithOrigin(conn, head, body, nil)
+}
+
+// 发送Msg，并附带写入请求的来源信息
+func (n *Node) sendMsgWithOrigin(conn net.Conn, head int, body []byte, origin *LogOrigin) error {
     ip, _  := gipv4.ParseAddress(conn.LocalAddr().String())
     info   := n.getNodeInfo()
     info.Ip = ip
-    s, _   := n.encodeMsg(head, body, info)
+    s, _   := n.encodeMsg(head, body, info, origin)
     return Send(conn, s)
 }
 
 // 对Msg进行二进制打包
-func (n *Node) encodeMsg(head int, body []byte, info *NodeInfo) ([]byte, error) {
+func (n *Node) encodeMsg(head int, body []byte, info *NodeInfo, origin *LogOrigin) ([]byte, error) {
     b1, err := gbinary.Encode(int32(head), int32(len(body)), body)
     if err != nil {
         glog.Error(err)
         return nil, err
     }
-    nameBytes  := []byte(info.Name)
-    groupBytes := []byte(info.Group)
-    id, _      := strconv.ParseUint(info.Id, 16, 32)
-    iplong     := gipv4.Ip2long(info.Ip)
-    b2, err    := gbinary.Encode(
+    nameBytes   := []byte(info.Name)
+    groupBytes  := []byte(info.Group)
+    originBytes := make([]byte, 0)
+    if origin != nil {
+        originBytes, _ = gjson.Encode(origin)
+    }
+    id, _       := strconv.ParseUint(info.Id, 16, 32)
+    iplong      := gipv4.Ip2long(info.Ip)
+    b2, err     := gbinary.Encode(
         int32(len(nameBytes)),
         nameBytes,
         int32(len(groupBytes)),
@@ -87,6 +104,10 @@ func (n *Node) encodeMsg(head int, body []byte, info *NodeInfo) ([]byte, error)
         info.RaftRole,
         info.LastLogId,
         info.LastServiceLogId,
+        info.Term,
+        info.CommitLogId,
+        int32(len(originBytes)),
+        originBytes,
         []byte(info.Version),
     )
     if err != nil {
@@ -96,25 +117,64 @@ func (n *Node) encodeMsg(head int, body []byte, info *NodeInfo) ([]byte, error)
     return append(b1, b2...), nil
 }
 
-// 对Msg进行二进制解包
+// 对Msg进行二进制解包，消息长度不足(格式错误或者格式不兼容)时返回nil
 func (n *Node) decodeMsg(b []byte) *Msg {
-    head          := gbinary.DecodeToInt32 (b)
-    bodySize      := gbinary.DecodeToInt32 (b[4:])
-    bodyBytes     := b[8 : 8 + bodySize]
-    nameSize      := gbinary.DecodeToInt32 (b[8 + bodySize:])
-    nameBytes     := b[8 + bodySize + 4 : 8 + bodySize + 4 + nameSize]
-    groupSize     := gbinary.DecodeToInt32 (b[8 + bodySize + 4 + nameSize:])
-    groupBytes    := b[8 + bodySize + 4 + nameSize + 4 : 8 + bodySize + 4 + nameSize + 4 + groupSize]
-    id            := gbinary.DecodeToUint32(b[8 + bodySize + 4 + nameSize + 4 + groupSize:])
-    iplong        := gbinary.DecodeToUint32(b[8 + bodySize + 4 + nameSize + 4 + groupSize + 4:])
-    role          := gbinary.DecodeToInt32 (b[8 + bodySize + 4 + nameSize + 4 + groupSize + 8:])
-    raft          := gbinary.DecodeToInt32 (b[8 + bodySize + 4 + nameSize + 4 + groupSize + 12:])
-    logid         := gbinary.DecodeToInt64 (b[8 + bodySize + 4 + nameSize + 4 + groupSize + 16:])
-    sid           := gbinary.DecodeToInt64 (b[8 + bodySize + 4 + nameSize + 4 + groupSize + 24:])
-    version       := b[8 + bodySize + 4 + nameSize + 4 + groupSize + 32:]
+    // head(4) + bodySize(4)
+    if len(b) < 8 {
+        return nil
+    }
+    head     := gbinary.DecodeToInt32(b)
+    bodySize := int(gbinary.DecodeToInt32(b[4:]))
+    pos      := 8
+    if bodySize < 0 || len(b) < pos + bodySize + 4 {
+        return nil
+    }
+    bodyBytes := b[pos : pos + bodySize]
+    pos       += bodySize
+    nameSize  := int(gbinary.DecodeToInt32(b[pos:]))
+    pos       += 4
+    if nameSize < 0 || len(b) < pos + nameSize + 4 {
+        return nil
+    }
+    nameBytes := b[pos : pos + nameSize]
+    pos       += nameSize
+    groupSize := int(gbinary.DecodeToInt32(b[pos:]))
+    pos       += 4
+    // 分组名称之后依次为id(4)、ip(4)、role(4)、raft(4)、logid(8)、serviceid(8)
+    if groupSize < 0 || len(b) < pos + groupSize + 32 {
+        return nil
+    }
+    groupBytes := b[pos : pos + groupSize]
+    pos        += groupSize
+    id         := gbinary.DecodeToUint32(b[pos:])
+    iplong     := gbinary.DecodeToUint32(b[pos + 4:])
+    role       := gbinary.DecodeToInt32 (b[pos + 8:])
+    raft       := gbinary.DecodeToInt32 (b[pos + 12:])
+    logid      := gbinary.DecodeToInt64 (b[pos + 16:])
+    sid        := gbinary.DecodeToInt64 (b[pos + 24:])
+    version    := b[pos + 32:]
+    // 1.7版本开始在版本号之前增加任期(8)、已提交logid(8)及来源信息(4+n)，
+    // 旧版本节点的消息中剩余内容均为版本号，此时这些字段为空，消息会因为版本号不一致被丢弃
+    var term, commitid int64
+    var origin *LogOrigin
+    if len(version) >= 20 {
+        originSize := int(gbinary.DecodeToInt32(version[16:]))
+        if originSize >= 0 && 20 + originSize <= len(version) {
+            term     = gbinary.DecodeToInt64(version)
+            commitid = gbinary.DecodeToInt64(version[8:])
+            if originSize > 0 {
+                var o LogOrigin
+                if gjson.DecodeTo(version[20 : 20 + originSize], &o) == nil {
+                    origin = &o
+                }
+            }
+            version = version[20 + originSize:]
+        }
+    }
     return &Msg {
-        Head: int(head),
-        Body: bodyBytes,
+        Head   : int(head),
+        Body   : bodyBytes,
+        Origin : origin,
         Info: NodeInfo{
             Name             : string(nameBytes),
             Group            : string(groupBytes),
@@ -125,6 +185,8 @@ func (n *Node) decodeMsg(b []byte) *Msg {
             RaftRole         : raft,
             LastLogId        : logid,
             LastServiceLogId : sid,
+            Term             : term,
+            CommitLogId      : commitid,
             Version          : string(version),
         },
     }
@@ -197,6 +259,9 @@ func (n *Node) Run() {
     fmt.Println("Host LogPath    :", logpathstr)
     fmt.Println("Host SavePath   :", n.getSavePath())
     fmt.Println("Host MinNode    :", n.MinNode)
+    fmt.Println("Host Election   :", n.Election)
+    fmt.Println("Host Priority   :", n.getLeaderPriority())
+    fmt.Println("Host Zone       :", n.Zone)
     fmt.Println("Last Log Id     :", n.getLastLogId())
     fmt.Println("Last Service Id :", n.getLastServiceLogId())
     fmt.Println("==================================================================================")
@@ -208,12 +273,34 @@ func (n *Node) Run() {
         // API只能本地访问
         api := ghttp.GetServer("localapi")
         api.SetAddr(fmt.Sprintf("127.0.0.1:%d", gPORT_API))
-        api.BindObjectRest("/kv",      &NodeApiKv{node: n})
-        api.BindObjectRest("/node",    &NodeApiNode{node: n})
-        api.BindObjectRest("/service", &NodeApiService{node: n})
-        api.BindObjectRest("/balance", &NodeApiBalance{node: n})
+        api.BindObjectRest("/kv",       &NodeApiKv{node: n})
+        api.BindObjectRest("/watch",    &NodeApiWatch{node: n})
+        api.BindObjectRest("/cas",      &NodeApiCas{node: n})
+        api.BindObjectRest("/session",  &NodeApiSession{node: n})
+        api.BindObjectRest("/txn",      &NodeApiTxn{node: n})
+        api.BindObjectRest("/history",  &NodeApiHistory{node: n})
+        api.BindObjectRest("/lock",     &NodeApiLock{node: n})
+        api.BindObjectRest("/election", &NodeApiElection{node: n})
+        api.BindObjectRest("/export",   &NodeApiExport{node: n})
+        api.BindObjectRest("/import",   &NodeApiImport{node: n})
+        api.BindObjectRest("/audit",    &NodeApiAudit{node: n})
+        api.BindObjectRest("/usage",    &NodeApiUsage{node: n})
+        api.BindObjectRest("/leader",   &NodeApiLeader{node: n})
+        api.BindObjectRest("/node",     &NodeApiNode{node: n})
+        api.BindObjectRest("/service",  &NodeApiService{node: n})
+        api.BindObjectRest("/balance",  &NodeApiBalance{node: n})
+        api.BindObjectRest("/monitor",  &NodeApiMonitor{node: n})
         api.Run()
     }()
+    // monitor节点额外提供只读的监控接口，可在运维网络中访问
+    if n.getRole() == gROLE_MONITOR {
+        go func() {
+            api := ghttp.GetServer("monitorapi")
+            api.SetAddr(fmt.Sprintf(":%d", gPORT_MONITOR))
+            api.BindObjectRest("/monitor",  &NodeApiMonitor{node: n})
+            api.Run()
+        }()
+    }
 
     // 配置同步
     go n.replicateConfigToLeader()
@@ -227,6 +314,10 @@ func (n *Node) Run() {
     go n.autoSavingHandler()
     // 服务健康检查
     go n.serviceHealthCheckHandler()
+    // leader优先级检查
+    go n.leaderPriorityHandler()
+    // 集群监控(monitor节点)
+    go n.monitorHandler()
 
     // 所有线程启动完成后，局域网自动扫描
     if n.AutoScan {
@@ -251,7 +342,7 @@ func (n *Node) initFromCommand() {
     }
     // 集群角色
     role := gconsole.Option.GetInt("Role")
-    if role < 0 || role > 2 {
+    if role < 0 || role > 3 {
         glog.Fatalln("invalid role setting, exit")
     } else {
         n.setRole(int32(role))
@@ -282,6 +373,49 @@ func (n *Node) initFromCommand() {
     if minNode != 0 {
         n.setMinNode(int32(minNode))
     }
+    // (可选)选举模式，score为延迟比分选举(默认)，raft为标准RAFT任期投票选举
+    if election := gconsole.Option.Get("Election"); election != "" {
+        n.setElectionModeFromConfig(election)
+    }
+    // (可选)成为leader的优先级及区域标签
+    if priority := gconsole.Option.GetInt("LeaderPriority"); priority < 0 {
+        glog.Fatalln("invalid leader priority setting, exit")
+    } else if priority > 0 {
+        n.setLeaderPriority(int32(priority))
+    }
+    if zone := gconsole.Option.Get("Zone"); zone != "" {
+        n.Zone = zone
+    }
+    // (可选)受信任的代理IP列表，多个IP使用','分隔
+    if proxies := gconsole.Option.Get("TrustedProxies"); proxies != "" {
+        n.TrustedProxies = strings.Split(strings.TrimSpace(proxies), ",")
+    }
+    // (可选)K-V配额限制，为0表示不限制，集群中所有Server节点应当使用相同的设置
+    if maxKeyLength := gconsole.Option.GetInt("MaxKeyLength"); maxKeyLength != 0 {
+        n.Quota.MaxKeyLength = maxKeyLength
+    }
+    if maxValueSize := gconsole.Option.GetInt("MaxValueSize"); maxValueSize != 0 {
+        n.Quota.MaxValueSize = maxValueSize
+    }
+    if maxKeys := gconsole.Option.GetInt("MaxKeys"); maxKeys != 0 {
+        n.Quota.MaxKeys = maxKeys
+    }
+    if maxDataSize, _ := strconv.ParseInt(gconsole.Option.Get("MaxDataSize"), 10, 64); maxDataSize != 0 {
+        n.Quota.MaxDataSize = maxDataSize
+    }
+    if n.Quota.MaxKeyLength < 0 || n.Quota.MaxValueSize < 0 || n.Quota.MaxKeys < 0 || n.Quota.MaxDataSize < 0 {
+        glog.Fatalln("invalid quota setting, exit")
+    }
+    // (可选)日志压缩设置，LogRetain为安全点之前保留的日志数量，LogArchivePath为归档目录(为空表示直接删除)
+    if gconsole.Option.Get("LogCompact") != "" {
+        n.LogCompact = gconsole.Option.GetBool("LogCompact")
+    }
+    if logRetain, _ := strconv.ParseInt(gconsole.Option.Get("LogRetain"), 10, 64); logRetain > 0 {
+        n.LogRetain = logRetain
+    }
+    if archivepath := gconsole.Option.Get("LogArchivePath"); archivepath != "" {
+        n.LogArchivePath = archivepath
+    }
     // (可选)初始化节点列表，包含自定义的所需添加的服务器IP或者域名列表
     peerstr := gconsole.Option.Get("Peers")
     if peerstr != "" {
@@ -325,7 +459,7 @@ func (n *Node) initFromCfg() {
     }
     // 集群角色
     role := j.GetInt("Role")
-    if role < 0 || role > 2 {
+    if role < 0 || role > 3 {
         glog.Fatalln("invalid role setting, exit")
     } else {
         n.setRole(int32(role))
@@ -354,6 +488,55 @@ func (n *Node) initFromCfg() {
     if minNode != 0 {
         n.setMinNode(int32(minNode))
     }
+    // (可选)选举模式，score为延迟比分选举(默认)，raft为标准RAFT任期投票选举
+    if election := j.GetString("Election"); election != "" {
+        n.setElectionModeFromConfig(election)
+    }
+    // (可选)成为leader的优先级及区域标签
+    if priority := j.GetInt("LeaderPriority"); priority < 0 {
+        glog.Fatalln("invalid leader priority setting, exit")
+    } else if priority > 0 {
+        n.setLeaderPriority(int32(priority))
+    }
+    if zone := j.GetString("Zone"); zone != "" {
+        n.Zone = zone
+    }
+    // (可选)受信任的代理IP列表
+    if proxies := j.GetArray("TrustedProxies"); proxies != nil {
+        n.TrustedProxies = make([]string, 0)
+        for _, v := range proxies {
+            n.TrustedProxies = append(n.TrustedProxies, v.(string))
+        }
+    }
+    // (可选)K-V配额限制，为0表示不限制，集群中所有Server节点应当使用相同的设置
+    if j.Get("MaxKeyLength") != nil {
+        n.Quota.MaxKeyLength = j.GetInt("MaxKeyLength")
+    }
+    if j.Get("MaxValueSize") != nil {
+        n.Quota.MaxValueSize = j.GetInt("MaxValueSize")
+    }
+    if j.Get("MaxKeys") != nil {
+        n.Quota.MaxKeys = j.GetInt("MaxKeys")
+    }
+    if j.Get("MaxDataSize") != nil {
+        n.Quota.MaxDataSize = j.GetInt64("MaxDataSize")
+    }
+    if n.Quota.MaxKeyLength < 0 || n.Quota.MaxValueSize < 0 || n.Quota.MaxKeys < 0 || n.Quota.MaxDataSize < 0 {
+        glog.Fatalln("invalid quota setting, exit")
+    }
+    // (可选)日志压缩设置，LogRetain为安全点之前保留的日志数量，LogArchivePath为归档目录(为空表示直接删除)
+    if j.Get("LogCompact") != nil {
+        n.LogCompact = j.GetBool("LogCompact")
+    }
+    if j.Get("LogRetain") != nil {
+        n.LogRetain = j.GetInt64("LogRetain")
+    }
+    if archivepath := j.GetString("LogArchivePath"); archivepath != "" {
+        n.LogArchivePath = archivepath
+    }
+    if n.LogRetain < 0 {
+        glog.Fatalln("invalid log retain setting, exit")
+    }
     // (可选)初始化节点列表，包含自定义的所需添加的服务器IP或者域名列表
     params := j.GetArray("Peers")
     if params != nil {
@@ -365,6 +548,15 @@ func (n *Node) initFromCfg() {
     }
 }
 
+// 从配置中设置选举模式
+func (n *Node) setElectionModeFromConfig(election string) {
+    election = strings.ToLower(strings.TrimSpace(election))
+    if election != gELECTION_MODE_SCORE && election != gELECTION_MODE_RAFT {
+        glog.Fatalln("invalid election setting, exit")
+    }
+    n.Election = election
+}
+
 // 从配置中设置SavePath
 func (n *Node) setSavePathFromConfig(savepath string) {
     if !gfile.Exists(savepath) {
@@ -393,6 +585,9 @@ func (n *Node) setLogPathFromConfig(logpath string) {
 
 // 从配置中设置Peers
 func (n *Node) setPeersFromConfig(peers []string) {
+    n.mutex.Lock()
+    n.CfgPeers = peers
+    n.mutex.Unlock()
     ip := n.getIp()
     for _, v := range peers {
         if v == ip {
@@ -439,12 +634,34 @@ func (n *Node) getNodeInfo() *NodeInfo {
         RaftRole         : n.getRaftRole(),
         LastLogId        : n.getLastLogId(),
         LastServiceLogId : n.getLastServiceLogId(),
+        Term             : n.getCurrentTerm(),
+        CommitLogId      : n.getCommitLogId(),
+        LeaderPriority   : n.getLeaderPriority(),
+        Zone             : n.Zone,
         Version          : gVERSION,
     }
 }
 
 // 向leader发送操作请求，并返回执行结果
 func (n *Node) SendToLeader(head int, port int, body []byte) ([]byte, error) {
+    return n.SendToLeaderWithTimeout(head, port, body, gTCP_READ_TIMEOUT * time.Millisecond)
+}
+
+// 向leader发送操作请求，并返回执行结果，自定义读取超时时间(用于阻塞型请求，例如watch)
+func (n *Node) SendToLeaderWithTimeout(head int, port int, body []byte, timeout time.Duration) ([]byte, error) {
+    return n.sendToLeader(head, port, body, timeout, nil)
+}
+
+// 向leader发送写入请求，并附带写入来源信息用于审计
+func (n *Node) SendToLeaderWithOrigin(head int, port int, body []byte, origin *LogOrigin) ([]byte, error) {
+    return n.sendToLeader(head, port, body, gTCP_READ_TIMEOUT * time.Millisecond, origin)
+}
+
+// 向leader发送请求，并返回执行结果
+func (n *Node) sendToLeader(head int, port int, body []byte, timeout time.Duration, origin *LogOrigin) ([]byte, error) {
+    if err := checkLogOriginDurability(origin); err != nil {
+        return nil, err
+    }
     leader := n.getLeader()
     if leader == nil {
         return nil, errors.New(fmt.Sprintf("leader not found, please try again after leader election done, request head: %d", head))
@@ -454,11 +671,17 @@ func (n *Node) SendToLeader(head int, port int, body []byte) ([]byte, error) {
         return nil, errors.New("could not connect to leader: " + leader.Ip)
     }
     defer conn.Close()
-    if err := n.sendMsg(conn, head, body); err != nil {
+    if err := n.sendMsgWithOrigin(conn, head, body, origin); err != nil {
         return nil, errors.New("sending request error: " + err.Error())
     } else {
-        msg := n.receiveMsg(conn)
-        if msg != nil && ((port == gPORT_RAFT && msg.Head != gMSG_RAFT_RESPONSE) || (port == gPORT_REPL && msg.Head != gMSG_REPL_RESPONSE)) {
+        msg := n.receiveMsgWithTimeout(conn, timeout)
+        if msg == nil {
+            return nil, errors.New(fmt.Sprintf("receive msg error from leader: %s, sent msg head: %d", leader.Ip, head))
+        } else if (port == gPORT_RAFT && msg.Head != gMSG_RAFT_RESPONSE) || (port == gPORT_REPL && msg.Head != gMSG_REPL_RESPONSE) {
+            // 失败时leader可能会返回具体的错误信息
+            if len(msg.Body) > 0 {
+                return nil, errors.New(string(msg.Body))
+            }
             return nil, errors.New(fmt.Sprintf("handling request error, response code: %d", msg.Head))
         } else {
             return msg.Body, nil
@@ -520,7 +743,11 @@ func (n *Node) compareLeaderWithRemoteNode(info *NodeInfo) bool {
     } else if n.getLastLogId() < info.LastLogId {
         return false
     }
-    // 如果数据一致，那么比较选举比分
+    // 如果数据一致，那么优先比较leader优先级
+    if n.getLeaderPriority() != info.LeaderPriority {
+        return n.getLeaderPriority() > info.LeaderPriority
+    }
+    // 如果优先级相同，那么比较选举比分
     result    := true
     data, err := gjson.Encode(map[string]interface{}{
         "score": n.getScore(),
@@ -534,12 +761,14 @@ func (n *Node) compareLeaderWithRemoteNode(info *NodeInfo) bool {
 }
 
 // 使用具体对比信息进行对比
-func (n *Node) compareLeaderWithRemoteNodeByDetail(logid int64, count int32, score int64) bool {
+func (n *Node) compareLeaderWithRemoteNodeByDetail(logid int64, priority int32, count int32, score int64) bool {
     result := false
     if n.getLastLogId() > logid {
         result = true
     } else if n.getLastLogId() == logid {
-        if n.getScoreCount() > count {
+        if n.getLeaderPriority() != priority {
+            result = n.getLeaderPriority() > priority
+        } else if n.getScoreCount() > count {
             result = true
         } else if n.getScoreCount() == count {
             if n.getScore() > score {
@@ -641,6 +870,22 @@ func (n *Node) getLastLogId() int64 {
     return atomic.LoadInt64(&n.LastLogId)
 }
 
+func (n *Node) getLastLogTerm() int64 {
+    return atomic.LoadInt64(&n.LastLogTerm)
+}
+
+func (n *Node) getSnapshotLogId() int64 {
+    return atomic.LoadInt64(&n.SnapshotLogId)
+}
+
+func (n *Node) getCompactLogId() int64 {
+    return atomic.LoadInt64(&n.CompactLogId)
+}
+
+func (n *Node) getCommitLogId() int64 {
+    return atomic.LoadInt64(&n.CommitLogId)
+}
+
 func (n *Node) getMinNode() int32 {
     return atomic.LoadInt32(&n.MinNode)
 }
@@ -687,6 +932,28 @@ func (n *Node) getLogEntryFileSavePathByBatchNo(no int64) string {
     return path
 }
 
+// 根据批次号获取日志文件归档的绝对路径
+func (n *Node) getLogEntryArchivePathByBatchNo(no int64) string {
+    n.mutex.RLock()
+    path := n.LogArchivePath + gfile.Separator + fmt.Sprintf("%d/%d", int(no/100), no)
+    n.mutex.RUnlock()
+    return path
+}
+
+func (n *Node) getRaftFilePath() string {
+    n.mutex.RLock()
+    path := n.SavePath + gfile.Separator + "dister.raft.db"
+    n.mutex.RUnlock()
+    return path
+}
+
+func (n *Node) getCompactFilePath() string {
+    n.mutex.RLock()
+    path := n.SavePath + gfile.Separator + "dister.compact.db"
+    n.mutex.RUnlock()
+    return path
+}
+
 // 获得logid存储的批次编号，用于文件存储的分组
 func (n *Node) getLogEntryBatachNo(id int64) int64 {
     return int64(id/gLOGENTRY_RANDOM_ID_SIZE/gLOGENTRY_FILE_SIZE)
@@ -742,6 +1009,11 @@ func (n *Node) setRaftRole(role int32) {
     r := n.getRaftRole()
     if r != role {
         glog.Printfln("role changed from %s to %s", raftRoleName(r), raftRoleName(role))
+        // 重新开始统计心跳回复，用于check-quorum
+        if role == gROLE_RAFT_LEADER {
+            n.HeartbeatAcks.Clear()
+            atomic.StoreInt64(&n.LeaderSince, gtime.Millisecond())
+        }
     }
     atomic.StoreInt32(&n.RaftRole, role)
 }
@@ -772,6 +1044,22 @@ func (n *Node) setLastLogId(id int64) {
     atomic.StoreInt64(&n.LastLogId, id)
 }
 
+func (n *Node) setLastLogTerm(term int64) {
+    atomic.StoreInt64(&n.LastLogTerm, term)
+}
+
+func (n *Node) setSnapshotLogId(id int64) {
+    atomic.StoreInt64(&n.SnapshotLogId, id)
+}
+
+func (n *Node) setCompactLogId(id int64) {
+    atomic.StoreInt64(&n.CompactLogId, id)
+}
+
+func (n *Node) setCommitLogId(id int64) {
+    atomic.StoreInt64(&n.CommitLogId, id)
+}
+
 func (n *Node) setLastServiceLogId(id int64) {
     atomic.StoreInt64(&n.LastServiceLogId, id)
 }
@@ -829,24 +1117,39 @@ func (n *Node) updatePeerStatus(Id string, status int32) {
 }
 
 // 更新选举截止时间
-// 改进：固定时间进行比分，看谁的比分更多
+// 改进：固定时间进行比分，看谁的比分更多；raft选举模式下使用随机的选举超时时间
 func (n *Node) updateElectionDeadline() {
-    atomic.StoreInt64(&n.ElectionDeadline, gtime.Millisecond() + gELECTION_TIMEOUT)
+    timeout := int64(gELECTION_TIMEOUT)
+    if n.isRaftElection() {
+        timeout += int64(grand.Rand(0, gELECTION_TIMEOUT_RANDOM))
+    }
+    atomic.StoreInt64(&n.ElectionDeadline, gtime.Millisecond() + timeout)
 }
 
-// 丢弃现有的DataMap数据，重新从数据文件中读取数据（**使用请慎重**）
+// 丢弃现有的DataMap数据，重新从数据文件中读取数据（**使用请慎重**），调用方需要持有dmutex锁
 func (n *Node) reloadDataMap() {
     var logid int64
     n.DataMap.Clear()
+    atomic.StoreInt64(&n.DataSize, 0)
+    n.DataMeta.Clear()
+    n.DataExpire.Clear()
+    n.Sessions.Clear()
+    n.Locks.Clear()
+    n.Voters.Clear()
+    n.resetAppliedLogId(0, 0)
     for {
         list := n.getLogEntriesByLastLogId(logid, 10000, false)
         if len(list) > 0 {
             for _, v := range list {
                 n.saveLogEntryToVar(&v)
                 logid = v.Id
+                n.setLastLogTerm(v.Term)
+                n.setAppliedLogId(v.Id, v.Term)
             }
         } else {
             break;
         }
     }
+    // 修复之后的日志与leader一致
+    n.updateMatchLogId(logid)
 }
\ No newline at end of file
@@ -2,15 +2,22 @@
 package dister
 
 import (
+    "sort"
     "errors"
+    "strings"
+    "gitee.com/johng/gf/g/os/gtime"
+    "gitee.com/johng/gf/g/os/gcache"
     "gitee.com/johng/gf/g/encoding/gjson"
 )
 
+// 键值不存在(或者已过期)
+var errDataNotFound = errors.New("data not found")
+
 // Api数据查询
 func (n *Node) getDataByApi(k string) ([]byte, error) {
     if k == "" {
         if n.DataMap.Size() > 1000 {
-            return nil, errors.New("too large data size, need a key to search")
+            return nil, errors.New("too large data size, need a key to search, or use prefix/limit to list by pages")
         } else {
             if b, err := gjson.Encode(*n.DataMap.Clone()); err != nil {
                 return nil, err
@@ -19,14 +26,150 @@ func (n *Node) getDataByApi(k string) ([]byte, error) {
             }
         }
     } else {
-        if n.DataMap.Contains(k) {
+        if n.DataMap.Contains(k) && !n.isKvExpired(k) {
             return []byte(n.DataMap.Get(k)), nil
         } else {
-            return nil, errors.New("data not found")
+            return nil, errDataNotFound
         }
     }
 }
 
+// Api数据查询，返回键值及其元数据
+func (n *Node) getDataWithMetaByApi(k string) ([]byte, error) {
+    if !n.DataMap.Contains(k) || n.isKvExpired(k) {
+        return nil, errDataNotFound
+    }
+    detail := KvDetail {
+        Key   : k,
+        Value : n.DataMap.Get(k),
+    }
+    detail.KvMeta, _ = n.getKvMeta(k)
+    if detail.Expire > 0 {
+        // 剩余生存时间向上取整，避免未过期的键值显示为0
+        detail.Ttl = (detail.Expire - gtime.Millisecond() + 999)/1000
+    }
+    return gjson.Encode(detail)
+}
+
+// Api数据列表查询，支持前缀查询、范围查询以及基于游标的分页，按照键名升序返回
+func (n *Node) getDataListByApi(q *KvQuery) ([]byte, error) {
+    limit := q.Limit
+    if limit <= 0 {
+        limit = gKV_LIST_LIMIT
+    } else if limit > gKV_LIST_LIMIT_MAX {
+        limit = gKV_LIST_LIMIT_MAX
+    }
+    keys  := n.getSortedDataKeys()
+    // 计算开始检索的位置
+    from  := q.Start
+    if q.Prefix > from {
+        from = q.Prefix
+    }
+    index := sort.SearchStrings(keys, from)
+    if q.Cursor != "" {
+        if i := sort.Search(len(keys), func(i int) bool { return keys[i] > q.Cursor }); i > index {
+            index = i
+        }
+    }
+    result := KvList {
+        List : make([]KvItem, 0),
+    }
+    for ; index < len(keys); index++ {
+        k := keys[index]
+        if q.Prefix != "" && !strings.HasPrefix(k, q.Prefix) {
+            break
+        }
+        if q.End != "" && k >= q.End {
+            break
+        }
+        // 键名列表有缓存，这里需要判断键名是否已经被删除或者过期
+        if !n.DataMap.Contains(k) || n.isKvExpired(k) {
+            continue
+        }
+        if len(result.List) == limit {
+            result.Next = result.List[limit - 1].Key
+            break
+        }
+        result.List = append(result.List, KvItem{k, n.DataMap.Get(k)})
+    }
+    return gjson.Encode(result)
+}
+
+// 分页获取指定键名前缀的所有键值，local为false时从leader获取
+func (n *Node) getDataMapByPrefix(prefix string, local bool) (map[string]string, error) {
+    m := make(map[string]string)
+    q := &KvQuery{Prefix: prefix, Limit: gKV_LIST_LIMIT_MAX}
+    for {
+        var b   []byte
+        var err error
+        if local {
+            b, err = n.getDataListByApi(q)
+        } else if b, err = gjson.Encode(q); err == nil {
+            b, err = n.SendToLeader(gMSG_API_DATA_LIST, gPORT_REPL, b)
+        }
+        if err != nil {
+            return nil, err
+        }
+        var list KvList
+        if err := gjson.DecodeTo(b, &list); err != nil {
+            return nil, err
+        }
+        for _, v := range list.List {
+            m[v.Key] = v.Value
+        }
+        if list.Next == "" {
+            break
+        }
+        q.Cursor = list.Next
+    }
+    return m, nil
+}
+
+// 已排序的键名列表缓存
+type sortedDataKeys struct {
+    logid int64    // 生成列表时已应用的logid
+    keys  []string // 按照字典序升序排列的键名列表
+}
+
+// 获取按照字典序升序排列的键名列表，只缓存最新的一份列表，已应用的logid变化之后重新生成并覆盖
+func (n *Node) getSortedDataKeys() []string {
+    key   := "dister_sorted_data_keys"
+    logid := n.getAppliedLogId()
+    if r := gcache.Get(key); r != nil && r.(*sortedDataKeys).logid == logid {
+        return r.(*sortedDataKeys).keys
+    }
+    m    := n.DataMap.Clone()
+    keys := make([]string, 0, len(*m))
+    for k, _ := range *m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    gcache.Set(key, &sortedDataKeys{logid, keys}, 60000)
+    return keys
+}
+
+// Api会话查询，id为空时返回所有会话
+func (n *Node) getSessionByApi(id string) ([]byte, error) {
+    if id == "" {
+        return gjson.Encode(*n.Sessions.Clone())
+    }
+    if r := n.Sessions.Get(id); r != nil {
+        return gjson.Encode(r)
+    }
+    return nil, errors.New("session not found")
+}
+
+// Api 分布式锁查询，不给定锁名称时返回所有的锁
+func (n *Node) getLockByApi(name string) ([]byte, error) {
+    if name == "" {
+        return gjson.Encode(*n.Locks.Clone())
+    }
+    if r := n.Locks.Get(name); r != nil {
+        return gjson.Encode(r)
+    }
+    return nil, errors.New("lock not found")
+}
+
 // Api Service查询
 func (n *Node) getServiceByApi(name string) ([]byte, error) {
     if name == "" {
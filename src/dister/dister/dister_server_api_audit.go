@@ -0,0 +1,64 @@
+// 返回格式统一：
+// {result:1, message:"", data:""}
+
+package dister
+
+import (
+    "errors"
+    "strconv"
+    "gitee.com/johng/gf/g/net/ghttp"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// 写入审计查询
+// 参数：k 键名(可选)，prefix 按照键名前缀匹配(可选)，since 只返回该时间之后的写入(可选，时间戳或者日期时间)，limit 最多返回最近的记录数量(可选)
+func (this *NodeApiAudit) Get(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    q := &AuditQuery {
+        Key    : r.GetRequestString("k"),
+        Prefix : isTrueString(r.GetRequestString("prefix")),
+    }
+    if since := r.GetRequestString("since"); since != "" {
+        t, err := parseAuditTime(since)
+        if err != nil {
+            w.WriteJson(0, err.Error(), nil)
+            return
+        }
+        q.Since = t
+    }
+    if limit := r.GetRequestString("limit"); limit != "" {
+        q.Limit, _ = strconv.Atoi(limit)
+    }
+    result, err := this.node.queryAuditRecords(q)
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if b, err := gjson.Encode(result); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", b)
+    }
+}
+
+// 查询写入审计记录，client节点从leader查询
+func (n *Node) queryAuditRecords(q *AuditQuery) (*AuditResult, error) {
+    if n.getRole() == gROLE_SERVER {
+        return n.getAuditRecords(q), nil
+    }
+    if n.getLeader() == nil {
+        return nil, errors.New("leader not found, please try again after leader election done")
+    }
+    b, err := gjson.Encode(q)
+    if err != nil {
+        return nil, err
+    }
+    b, err  = n.SendToLeader(gMSG_API_AUDIT, gPORT_REPL, b)
+    if err != nil {
+        return nil, err
+    }
+    var result AuditResult
+    if err := gjson.DecodeTo(b, &result); err != nil {
+        return nil, err
+    }
+    return &result, nil
+}
@@ -0,0 +1,53 @@
+// 返回格式统一：
+// {result:1, message:"", data:""}
+
+package dister
+
+import (
+    "fmt"
+    "gitee.com/johng/gf/g/net/ghttp"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// K-V 比较并设置(compare-and-swap)
+// 提交数据格式：{"k":"键名", "v":"新键值", "prev":"期望的当前键值", "logid":期望的键值最后修改logid}
+// 比较失败时返回result为0，data中包含比较时的键值信息
+func (this *NodeApiCas) Post(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    var cas KvCas
+    if err := gjson.DecodeTo(r.GetRaw(), &cas); err != nil {
+        w.WriteJson(0, "invalid data type: " + err.Error(), nil)
+        return
+    }
+    if cas.Key == "" {
+        w.WriteJson(0, "incomplete input: k is required", nil)
+        return
+    }
+    if err := checkElectionKeys(cas.Key); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if cas.Prev == nil && cas.LogId == nil {
+        w.WriteJson(0, "incomplete input: prev or logid is required", nil)
+        return
+    }
+    data, err := gjson.Encode(cas)
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    b, err := this.node.SendToLeaderWithOrigin(gMSG_REPL_DATA_CAS, gPORT_REPL, data, this.node.makeLogOriginFromRequest(r))
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    var res KvCasResult
+    if err := gjson.DecodeTo(b, &res); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if res.Succeeded {
+        w.WriteJson(1, "ok", b)
+    } else {
+        w.WriteJson(0, fmt.Sprintf("compare failed, key: %s, exist: %v, modify logid: %d", cas.Key, res.Exist, res.ModifyId), b)
+    }
+}
@@ -0,0 +1,117 @@
+// 返回格式统一：
+// {result:1, message:"", data:""}
+
+package dister
+
+import (
+    "time"
+    "errors"
+    "strconv"
+    "gitee.com/johng/gf/g/net/ghttp"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// 观察选举的当选信息(长轮询)
+// 参数：name 选举名称，logid 调用方最后一次获取到的logid(为空时立即返回当前的当选信息)，timeout 等待超时时间(毫秒)
+func (this *NodeApiElection) Get(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    name       := r.GetRequestString("name")
+    logid, _   := strconv.ParseInt(r.GetRequestString("logid"),   10, 64)
+    timeout, _ := strconv.ParseInt(r.GetRequestString("timeout"), 10, 64)
+    if name == "" {
+        w.WriteJson(0, "incomplete input: name is required", nil)
+        return
+    }
+    if timeout <= 0 {
+        timeout = gWATCH_TIMEOUT
+    } else if timeout > gWATCH_TIMEOUT_MAX {
+        timeout = gWATCH_TIMEOUT_MAX
+    }
+    var b   []byte
+    var err error
+    if this.node.getRole() != gROLE_SERVER {
+        b, err = gjson.Encode(map[string]interface{} {
+            "name"    : name,
+            "logid"   : logid,
+            "timeout" : timeout,
+        })
+        if err == nil {
+            // 读取超时时间需要在观察超时时间的基础上增加通信的超时时间
+            b, err = this.node.SendToLeaderWithTimeout(gMSG_API_ELECTION_OBSERVE, gPORT_REPL, b, time.Duration(timeout + gTCP_READ_TIMEOUT) * time.Millisecond)
+        }
+    } else {
+        b, err = gjson.Encode(this.node.observeElection(name, logid, timeout))
+    }
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", b)
+    }
+}
+
+// 竞选
+// 提交数据格式：{"name":"选举名称", "session":"会话ID", "value":"当选后公布的信息", "timeout":阻塞等待时间(毫秒)}
+// 当选时返回result为1，否则返回result为0，data中包含当前的当选信息
+func (this *NodeApiElection) Post(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    req, err := this.getElectionRequest(r)
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if req.Timeout < 0 {
+        req.Timeout = 0
+    } else if req.Timeout > gLOCK_WAIT_TIMEOUT_MAX {
+        req.Timeout = gLOCK_WAIT_TIMEOUT_MAX
+    }
+    data, err := gjson.Encode(req)
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    b, err := this.node.sendToLeader(gMSG_REPL_ELECTION_CAMPAIGN, gPORT_REPL, data, time.Duration(req.Timeout + gTCP_READ_TIMEOUT) * time.Millisecond, this.node.makeLogOriginFromRequest(r))
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    var election Election
+    if err := gjson.DecodeTo(b, &election); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if election.Session == req.Session {
+        w.WriteJson(1, "ok", b)
+    } else {
+        w.WriteJson(0, "election is held by session: " + election.Session, b)
+    }
+}
+
+// 退选
+// 提交数据格式：{"name":"选举名称", "session":"会话ID"}
+func (this *NodeApiElection) Delete(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    req, err := this.getElectionRequest(r)
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    data, err := gjson.Encode(ElectionRequest{Name: req.Name, Session: req.Session})
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if _, err := this.node.SendToLeaderWithOrigin(gMSG_REPL_ELECTION_RESIGN, gPORT_REPL, data, this.node.makeLogOriginFromRequest(r)); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", nil)
+    }
+}
+
+// 解析并检查选举操作的提交数据
+func (this *NodeApiElection) getElectionRequest(r *ghttp.ClientRequest) (*ElectionRequest, error) {
+    var req ElectionRequest
+    if err := gjson.DecodeTo(r.GetRaw(), &req); err != nil {
+        return nil, errors.New("invalid data type: " + err.Error())
+    }
+    if req.Name == "" || req.Session == "" {
+        return nil, errors.New("incomplete input: name and session are required")
+    }
+    return &req, nil
+}
@@ -0,0 +1,71 @@
+// 返回格式统一：
+// {result:1, message:"", data:""}
+
+package dister
+
+import (
+    "strings"
+    "gitee.com/johng/gf/g/net/ghttp"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// K-V 导出
+// 参数：prefix 键名前缀(可选)，format 导出格式(json/yaml/properties/env，默认json)，consistency 读取一致性级别(可选)
+// 返回data为导出的文件内容
+func (this *NodeApiExport) Get(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    format, err := checkKvFormat(strings.ToLower(r.GetRequestString("format")))
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    local, err := this.node.prepareRead(r.GetRequestString("consistency"))
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    m, err := this.node.getDataMapByPrefix(r.GetRequestString("prefix"), local)
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if b, err := encodeKvFormat(format, m); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", b)
+    }
+}
+
+// K-V 导入
+// 参数：format 提交内容的格式(json/yaml/properties/env，默认json)，prefix 导入时为键名增加的前缀(可选)，dryrun 只比较差异不写入(可选)
+// 提交数据为导入的文件内容，返回data中包含新增、修改的键值列表以及写入的logid列表
+func (this *NodeApiImport) Post(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    format, err := checkKvFormat(strings.ToLower(r.GetRequestString("format")))
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    m, err := decodeKvFormat(format, r.GetRaw())
+    if err != nil {
+        w.WriteJson(0, "invalid data content: " + err.Error(), nil)
+        return
+    }
+    prefix := r.GetRequestString("prefix")
+    items  := make(map[string]string, len(m))
+    for k, v := range m {
+        if k == "" {
+            w.WriteJson(0, "invalid data content: empty key", nil)
+            return
+        }
+        items[prefix + k] = v
+    }
+    data, err := gjson.Encode(KvImport{items, isTrueString(r.GetRequestString("dryrun"))})
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if b, err := this.node.SendToLeaderWithOrigin(gMSG_API_DATA_IMPORT, gPORT_REPL, data, this.node.makeLogOriginFromRequest(r)); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", b)
+    }
+}
@@ -0,0 +1,55 @@
+// 返回格式统一：
+// {result:1, message:"", data:""}
+
+package dister
+
+import (
+    "errors"
+    "strconv"
+    "gitee.com/johng/gf/g/net/ghttp"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// K-V 历史查询
+// 参数：k 键名，at 只返回该logid(包含)之前的变化(可选)
+func (this *NodeApiHistory) Get(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    k := r.GetRequestString("k")
+    if k == "" {
+        w.WriteJson(0, "incomplete input: k is required", nil)
+        return
+    }
+    at, _ := strconv.ParseInt(r.GetRequestString("at"), 10, 64)
+    history, err := this.node.queryDataHistory(k, at, this.node.getRole() == gROLE_SERVER)
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if b, err := gjson.Encode(history); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", b)
+    }
+}
+
+// 查询键名的数据变化历史，local为false时(client节点或者一致性读取需要)从leader查询
+func (n *Node) queryDataHistory(k string, at int64, local bool) (*KvHistory, error) {
+    if local {
+        return n.getDataHistory(k, at), nil
+    }
+    if n.getLeader() == nil {
+        return nil, errors.New("leader not found, please try again after leader election done")
+    }
+    b, err := gjson.Encode(KvHistoryQuery{k, at})
+    if err != nil {
+        return nil, err
+    }
+    b, err  = n.SendToLeader(gMSG_API_DATA_HISTORY, gPORT_REPL, b)
+    if err != nil {
+        return nil, err
+    }
+    var history KvHistory
+    if err := gjson.DecodeTo(b, &history); err != nil {
+        return nil, err
+    }
+    return &history, nil
+}
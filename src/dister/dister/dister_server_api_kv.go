@@ -6,15 +6,37 @@ package dister
 import (
     "fmt"
     "errors"
+    "strconv"
     "gitee.com/johng/gf/g/net/ghttp"
     "gitee.com/johng/gf/g/encoding/gjson"
 )
 
 
 // K-V 查询
+// 当给定prefix/start/end/cursor/limit任一参数时，按照键名升序分页返回键值列表；
+// 当给定meta参数时，返回键值及其元数据；
+// 当给定at参数时，返回键值在该logid时的历史值；
+// 通过consistency参数指定读取一致性级别：stale, default(默认), consistent
 func (this *NodeApiKv) Get(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
-    k := r.GetRequestString("k")
-    if this.node.getRole() != gROLE_SERVER {
+    k          := r.GetRequestString("k")
+    local, err := this.node.prepareRead(r.GetRequestString("consistency"))
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if q := this.getKvQuery(r); k == "" && q != nil {
+        this.getList(q, local, w)
+        return
+    }
+    if k != "" && isTrueString(r.GetRequestString("meta")) {
+        this.getMeta(k, local, w)
+        return
+    }
+    if at, _ := strconv.ParseInt(r.GetRequestString("at"), 10, 64); k != "" && at > 0 {
+        this.getAt(k, at, local, w)
+        return
+    }
+    if !local {
         b, err := this.getDataFromLeader(k)
         if err != nil {
             w.WriteJson(0, err.Error(), nil)
@@ -30,7 +52,85 @@ func (this *NodeApiKv) Get(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.Ser
     }
 }
 
+// K-V 列表分页查询
+func (this *NodeApiKv) getList(q *KvQuery, local bool, w *ghttp.ServerResponse) {
+    if !local {
+        b, err := this.getDataListFromLeader(q)
+        if err != nil {
+            w.WriteJson(0, err.Error(), nil)
+        } else {
+            w.WriteJson(1, "ok", b)
+        }
+    } else {
+        if b, err := this.node.getDataListByApi(q); err != nil {
+            w.WriteJson(0, err.Error(), nil)
+        } else {
+            w.WriteJson(1, "ok", b)
+        }
+    }
+}
+
+// K-V 查询，返回键值及其元数据，键名不存在时返回码为gAPI_RESULT_NOT_FOUND
+func (this *NodeApiKv) getMeta(k string, local bool, w *ghttp.ServerResponse) {
+    var b   []byte
+    var err error
+    if !local {
+        if b, err = this.node.SendToLeader(gMSG_API_DATA_META, gPORT_REPL, []byte(k)); err == nil && len(b) == 0 {
+            err = errDataNotFound
+        }
+    } else {
+        b, err = this.node.getDataWithMetaByApi(k)
+    }
+    if err == errDataNotFound {
+        w.WriteJson(gAPI_RESULT_NOT_FOUND, err.Error(), nil)
+    } else if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", b)
+    }
+}
+
+// K-V 历史查询，返回键值在指定logid时的值
+func (this *NodeApiKv) getAt(k string, at int64, local bool, w *ghttp.ServerResponse) {
+    history, err := this.node.queryDataHistory(k, at, local)
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    // 压缩点之前的变化已不存在，无法确定该logid时的键值
+    if at < history.Compacted || (history.Compacted > 0 && len(history.Events) == 0) {
+        w.WriteJson(0, fmt.Sprintf("log at logid %d has been compacted, earliest available logid: %d", at, history.Compacted), nil)
+        return
+    }
+    if v, ok := history.valueAt(); ok {
+        w.WriteJson(1, "ok", []byte(v))
+    } else {
+        w.WriteJson(0, fmt.Sprintf("data not found at logid: %d", at), nil)
+    }
+}
+
+// 从请求中获取列表查询条件，如果没有任何列表查询参数，那么返回nil
+func (this *NodeApiKv) getKvQuery(r *ghttp.ClientRequest) *KvQuery {
+    q := &KvQuery {
+        Prefix : r.GetRequestString("prefix"),
+        Start  : r.GetRequestString("start"),
+        End    : r.GetRequestString("end"),
+        Cursor : r.GetRequestString("cursor"),
+    }
+    limit := r.GetRequestString("limit")
+    if limit != "" {
+        q.Limit, _ = strconv.Atoi(limit)
+    }
+    if q.Prefix == "" && q.Start == "" && q.End == "" && q.Cursor == "" && limit == "" {
+        return nil
+    }
+    return q
+}
+
 // K-V 新增/修改
+// 当给定ttl参数(秒)时，提交的键值将在ttl秒之后由leader自动删除；
+// 当给定session参数(会话ID)时，提交的键值将绑定该会话，会话销毁或者失效时由leader自动删除；
+// 所有写入接口均可通过durability参数指定写入持久化级别(leader/one/quorum/all)，默认为quorum
 func (this *NodeApiKv) Post(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
     items := make(map[string]string)
     err   := gjson.DecodeTo(r.GetRaw(), &items)
@@ -38,11 +138,37 @@ func (this *NodeApiKv) Post(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.Se
         w.WriteJson(0, "invalid data type: " + err.Error(), nil)
         return
     }
-    data, err := gjson.Encode(items)
+    for k, _ := range items {
+        if err := checkElectionKeys(k); err != nil {
+            w.WriteJson(0, err.Error(), nil)
+            return
+        }
+    }
+    head    := gMSG_REPL_DATA_SET
+    ttl, _  := strconv.ParseInt(r.GetRequestString("ttl"), 10, 64)
+    session := r.GetRequestString("session")
+    if ttl < 0 {
+        w.WriteJson(0, "invalid ttl: must not be negative", nil)
+        return
+    }
+    if ttl > 0 && session != "" {
+        w.WriteJson(0, "invalid input: ttl and session cannot be used together", nil)
+        return
+    }
+    var data []byte
+    if ttl > 0 {
+        head      = gMSG_REPL_DATA_SET_TTL
+        data, err = gjson.Encode(KvTtlItems{Items: items, Ttl: ttl})
+    } else if session != "" {
+        head      = gMSG_REPL_DATA_SET_SESSION
+        data, err = gjson.Encode(KvSessionItems{Items: items, Session: session})
+    } else {
+        data, err = gjson.Encode(items)
+    }
     if err != nil {
         w.WriteJson(0, err.Error(), nil)
     } else {
-        if _, err  = this.node.SendToLeader(gMSG_REPL_DATA_SET, gPORT_REPL, data); err != nil {
+        if _, err  = this.node.SendToLeaderWithOrigin(head, gPORT_REPL, data, this.node.makeLogOriginFromRequest(r)); err != nil {
             w.WriteJson(0, err.Error(), nil)
         } else {
             w.WriteJson(1, "ok", nil)
@@ -57,11 +183,15 @@ func (this *NodeApiKv) Delete(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.
         w.WriteJson(0, "invalid data type: " + err.Error(), nil)
         return
     }
+    if err := checkElectionKeys(list...); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
     b, err := gjson.Encode(list)
     if err != nil {
         w.WriteJson(0, err.Error(), nil)
     } else {
-        if _, err  = this.node.SendToLeader(gMSG_REPL_DATA_REMOVE, gPORT_REPL, b); err != nil {
+        if _, err  = this.node.SendToLeaderWithOrigin(gMSG_REPL_DATA_REMOVE, gPORT_REPL, b, this.node.makeLogOriginFromRequest(r)); err != nil {
             w.WriteJson(0, err.Error(), nil)
         } else {
             w.WriteJson(1, "ok", nil)
@@ -77,3 +207,16 @@ func (this *NodeApiKv) getDataFromLeader(k string) ([]byte, error) {
     }
     return this.node.SendToLeader(gMSG_API_DATA_GET, gPORT_REPL, []byte(k))
 }
+
+// 从Leader分页查询数据列表
+func (this *NodeApiKv) getDataListFromLeader(q *KvQuery) ([]byte, error) {
+    leader := this.node.getLeader()
+    if leader == nil {
+        return nil, errors.New(fmt.Sprintf("leader not found, please try again after leader election done"))
+    }
+    b, err := gjson.Encode(q)
+    if err != nil {
+        return nil, err
+    }
+    return this.node.SendToLeader(gMSG_API_DATA_LIST, gPORT_REPL, b)
+}
@@ -0,0 +1,36 @@
+// 返回格式统一：
+// {result:1, message:"", data:""}
+
+package dister
+
+import (
+    "time"
+    "gitee.com/johng/gf/g/net/ghttp"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// 查询当前leader
+func (this *NodeApiLeader) Get(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    leader := this.node.getLeader()
+    if leader == nil {
+        w.WriteJson(0, "leader not found, please try again after leader election done", nil)
+        return
+    }
+    if b, err := gjson.Encode(leader); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", b)
+    }
+}
+
+// leader转移
+// 参数：node 目标节点的ID、名称或者IP(可选，为空时由leader选择日志最新的存活server节点)，返回data为目标节点信息
+func (this *NodeApiLeader) Post(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    node    := r.GetRequestString("node")
+    timeout := time.Duration(gLEADER_TRANSFER_TIMEOUT + gTCP_READ_TIMEOUT) * time.Millisecond
+    if b, err := this.node.SendToLeaderWithTimeout(gMSG_API_LEADER_TRANSFER, gPORT_REPL, []byte(node), timeout); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", b)
+    }
+}
@@ -0,0 +1,135 @@
+// 返回格式统一：
+// {result:1, message:"", data:""}
+
+package dister
+
+import (
+    "time"
+    "errors"
+    "gitee.com/johng/gf/g/net/ghttp"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// 分布式锁查询，不给定name时返回所有的锁
+func (this *NodeApiLock) Get(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    if b, err := this.getLock(r.GetRequestString("name")); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", b)
+    }
+}
+
+// 获取分布式锁
+// 提交数据格式：{"name":"锁名称", "session":"会话ID", "timeout":阻塞等待时间(毫秒)}
+// 获得锁时返回result为1，data中的token为防护令牌，调用方应当在访问受保护资源时携带该令牌；
+// 等待超时或者不等待时返回result为0，data中包含锁的当前状态
+func (this *NodeApiLock) Post(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    req, err := this.getLockRequest(r)
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if req.Timeout < 0 {
+        req.Timeout = 0
+    } else if req.Timeout > gLOCK_WAIT_TIMEOUT_MAX {
+        req.Timeout = gLOCK_WAIT_TIMEOUT_MAX
+    }
+    data, err := gjson.Encode(req)
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    // 读取超时时间需要在等待时间的基础上增加通信的超时时间
+    b, err := this.node.sendToLeader(gMSG_REPL_LOCK_ACQUIRE, gPORT_REPL, data, time.Duration(req.Timeout + gTCP_READ_TIMEOUT) * time.Millisecond, this.node.makeLogOriginFromRequest(r))
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    var res LockResult
+    if err := gjson.DecodeTo(b, &res); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if res.Acquired {
+        w.WriteJson(1, "ok", b)
+    } else {
+        w.WriteJson(0, "lock is held by session: " + res.Owner, b)
+    }
+}
+
+// 分布式锁续期，即对持有锁的会话进行续期
+// 提交数据格式：{"name":"锁名称", "session":"会话ID"}
+func (this *NodeApiLock) Put(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    req, err := this.getLockRequest(r)
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if _, err := this.node.SendToLeader(gMSG_API_SESSION_RENEW, gPORT_REPL, []byte(req.Session)); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    b, err := this.getLock(req.Name)
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    var lock Lock
+    if err := gjson.DecodeTo(b, &lock); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if lock.Owner != req.Session {
+        w.WriteJson(0, "lock not held by session: " + req.Session, b)
+    } else {
+        w.WriteJson(1, "ok", b)
+    }
+}
+
+// 释放分布式锁，正在等待的会话调用时表示退出等待
+// 提交数据格式：{"name":"锁名称", "session":"会话ID"}
+func (this *NodeApiLock) Delete(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    req, err := this.getLockRequest(r)
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    data, err := gjson.Encode(LockRequest{Name: req.Name, Session: req.Session})
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if _, err := this.node.SendToLeaderWithOrigin(gMSG_REPL_LOCK_RELEASE, gPORT_REPL, data, this.node.makeLogOriginFromRequest(r)); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", nil)
+    }
+}
+
+// 解析并检查锁操作的提交数据
+func (this *NodeApiLock) getLockRequest(r *ghttp.ClientRequest) (*LockRequest, error) {
+    var req LockRequest
+    if err := gjson.DecodeTo(r.GetRaw(), &req); err != nil {
+        return nil, errors.New("invalid data type: " + err.Error())
+    }
+    if req.Name == "" || req.Session == "" {
+        return nil, errors.New("incomplete input: name and session are required")
+    }
+    // 选举锁只能通过选举接口获取及释放
+    if err := checkElectionKeys(req.Name); err != nil {
+        return nil, err
+    }
+    return &req, nil
+}
+
+// 查询锁信息，client节点从leader查询
+func (this *NodeApiLock) getLock(name string) ([]byte, error) {
+    if this.node.getRole() == gROLE_SERVER {
+        return this.node.getLockByApi(name)
+    }
+    b, err := this.node.SendToLeader(gMSG_API_LOCK_GET, gPORT_REPL, []byte(name))
+    if err == nil && len(b) == 0 {
+        err = errors.New("lock not found")
+    }
+    return b, err
+}
@@ -0,0 +1,42 @@
+// 返回格式统一：
+// {result:1, message:"", data:""}
+
+package dister
+
+import (
+    "strconv"
+    "gitee.com/johng/gf/g/net/ghttp"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// 集群监控查询(只在monitor节点上可用)
+// 参数：type 事件类型leader/peer/lag/service(可选)，since 只返回该时间之后的事件及采样(可选，时间戳或者日期时间)，limit 事件及采样分别最多返回最近的记录数量(可选)
+func (this *NodeApiMonitor) Get(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    if this.node.getRole() != gROLE_MONITOR {
+        w.WriteJson(0, "cluster monitoring is only available on monitor nodes", nil)
+        return
+    }
+    q := &MonitorQuery {
+        Type : r.GetRequestString("type"),
+    }
+    if !isValidMonitorEventType(q.Type) {
+        w.WriteJson(0, "invalid type: " + q.Type + ", should be one of: leader, peer, lag, service", nil)
+        return
+    }
+    if since := r.GetRequestString("since"); since != "" {
+        t, err := parseAuditTime(since)
+        if err != nil {
+            w.WriteJson(0, err.Error(), nil)
+            return
+        }
+        q.Since = t
+    }
+    if limit := r.GetRequestString("limit"); limit != "" {
+        q.Limit, _ = strconv.Atoi(limit)
+    }
+    if b, err := gjson.Encode(this.node.getMonitorReport(q)); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", b)
+    }
+}
@@ -4,6 +4,7 @@
 package dister
 
 import (
+    "time"
     "gitee.com/johng/gf/g/net/ghttp"
     "gitee.com/johng/gf/g/encoding/gjson"
 )
@@ -17,7 +18,7 @@ func (this *NodeApiNode) Get(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.S
     }
 }
 
-// 新增/修改Peer
+// 新增/修改Peer，server节点作为投票成员加入集群，返回data为每个节点的变更结果(包含变更提交的logid)
 func (this *NodeApiNode) Post(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
     list := make([]string, 0)
     err  := gjson.DecodeTo(r.GetRaw(), &list)
@@ -30,15 +31,16 @@ func (this *NodeApiNode) Post(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.
         w.WriteJson(0, err.Error(), nil)
         return
     }
-    _, err  = this.node.SendToLeader(gMSG_API_PEERS_ADD, gPORT_REPL, b)
-    if err != nil {
+    // 每个server节点需要等待其日志追上leader之后才提交成员变更
+    timeout := time.Duration(gMEMBER_CATCHUP_TIMEOUT*len(list) + gTCP_READ_TIMEOUT) * time.Millisecond
+    if b, err = this.node.sendToLeader(gMSG_API_PEERS_ADD, gPORT_REPL, b, timeout, this.node.makeLogOriginFromRequest(r)); err != nil {
         w.WriteJson(0, err.Error(), nil)
     } else {
-        w.WriteJson(1, "ok", nil)
+        w.WriteJson(1, "ok", b)
     }
 }
 
-// 删除Peer
+// 删除Peer，参数为节点ID、名称或者IP列表，返回data为每个节点的变更结果(包含变更提交的logid)
 func (this *NodeApiNode) Delete(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
     list := make([]string, 0)
     err  := gjson.DecodeTo(r.GetRaw(), &list)
@@ -51,10 +53,10 @@ func (this *NodeApiNode) Delete(s *ghttp.Server, r *ghttp.ClientRequest, w *ghtt
         w.WriteJson(0, err.Error(), nil)
         return
     }
-    _, err  = this.node.SendToLeader(gMSG_API_PEERS_REMOVE, gPORT_REPL, b)
-    if err != nil {
+    timeout := time.Duration(gTCP_READ_TIMEOUT*(len(list) + 1)) * time.Millisecond
+    if b, err = this.node.sendToLeader(gMSG_API_PEERS_REMOVE, gPORT_REPL, b, timeout, this.node.makeLogOriginFromRequest(r)); err != nil {
         w.WriteJson(0, err.Error(), nil)
     } else {
-        w.WriteJson(1, "ok", nil)
+        w.WriteJson(1, "ok", b)
     }
 }
@@ -0,0 +1,88 @@
+// 返回格式统一：
+// {result:1, message:"", data:""}
+
+package dister
+
+import (
+    "fmt"
+    "errors"
+    "gitee.com/johng/gf/g/net/ghttp"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// 会话查询，不给定id时返回所有会话
+func (this *NodeApiSession) Get(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    id := r.GetRequestString("id")
+    var b   []byte
+    var err error
+    if this.node.getRole() != gROLE_SERVER {
+        if b, err = this.node.SendToLeader(gMSG_API_SESSION_GET, gPORT_REPL, []byte(id)); err == nil && len(b) == 0 {
+            err = errors.New("session not found")
+        }
+    } else {
+        b, err = this.node.getSessionByApi(id)
+    }
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", b)
+    }
+}
+
+// 创建会话
+// 提交数据格式：{"name":"会话名称", "ttl":会话保持时间(秒)}，返回创建的会话信息(包含会话ID)
+func (this *NodeApiSession) Post(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    var session Session
+    if err := gjson.DecodeTo(r.GetRaw(), &session); err != nil {
+        w.WriteJson(0, "invalid data type: " + err.Error(), nil)
+        return
+    }
+    if session.Ttl < gSESSION_TTL_MIN || session.Ttl > gSESSION_TTL_MAX {
+        w.WriteJson(0, fmt.Sprintf("invalid ttl: should be between %d and %d seconds", gSESSION_TTL_MIN, gSESSION_TTL_MAX), nil)
+        return
+    }
+    data, err := gjson.Encode(session)
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if b, err := this.node.SendToLeaderWithOrigin(gMSG_REPL_SESSION_CREATE, gPORT_REPL, data, this.node.makeLogOriginFromRequest(r)); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", b)
+    }
+}
+
+// 会话续期，客户端需要在会话保持时间内定期调用
+func (this *NodeApiSession) Put(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    id := r.GetRequestString("id")
+    if id == "" {
+        w.WriteJson(0, "incomplete input: id is required", nil)
+        return
+    }
+    if _, err := this.node.SendToLeader(gMSG_API_SESSION_RENEW, gPORT_REPL, []byte(id)); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", nil)
+    }
+}
+
+// 销毁会话，绑定会话的键值将被同时删除
+// 提交数据格式：["会话ID1", "会话ID2", ...]
+func (this *NodeApiSession) Delete(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    list := make([]string, 0)
+    if err := gjson.DecodeTo(r.GetRaw(), &list); err != nil {
+        w.WriteJson(0, "invalid data type: " + err.Error(), nil)
+        return
+    }
+    b, err := gjson.Encode(list)
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if _, err = this.node.SendToLeaderWithOrigin(gMSG_REPL_SESSION_DESTROY, gPORT_REPL, b, this.node.makeLogOriginFromRequest(r)); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", nil)
+    }
+}
@@ -0,0 +1,39 @@
+// 返回格式统一：
+// {result:1, message:"", data:""}
+
+package dister
+
+import (
+    "gitee.com/johng/gf/g/net/ghttp"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// K-V 事务
+// 提交数据格式：
+// {
+//     "compare": [{"k":"键名", "op":"=", "v":"键值"}, {"k":"键名", "op":"=", "logid":键值最后修改logid}, ...],
+//     "then":    [{"op":"set", "k":"键名", "v":"键值"}, {"op":"delete", "k":"键名"}, ...],
+//     "else":    [...]
+// }
+// 返回data中的succeeded表示比较条件是否全部成立，logid为写入的logid
+func (this *NodeApiTxn) Post(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    var txn KvTxn
+    if err := gjson.DecodeTo(r.GetRaw(), &txn); err != nil {
+        w.WriteJson(0, "invalid data type: " + err.Error(), nil)
+        return
+    }
+    if err := checkKvTxn(&txn); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    data, err := gjson.Encode(txn)
+    if err != nil {
+        w.WriteJson(0, err.Error(), nil)
+        return
+    }
+    if b, err := this.node.SendToLeaderWithOrigin(gMSG_REPL_DATA_TXN, gPORT_REPL, data, this.node.makeLogOriginFromRequest(r)); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", b)
+    }
+}
@@ -0,0 +1,27 @@
+// 返回格式统一：
+// {result:1, message:"", data:""}
+
+package dister
+
+import (
+    "gitee.com/johng/gf/g/net/ghttp"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// K-V用量查询，配额由leader检查，因此用量及配额均以leader为准
+// 返回data中包含键值数量、数据总字节数以及配额限制(为0表示不限制)
+func (this *NodeApiUsage) Get(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    if this.node.getRaftRole() == gROLE_RAFT_LEADER {
+        if b, err := gjson.Encode(this.node.getKvUsage()); err != nil {
+            w.WriteJson(0, err.Error(), nil)
+        } else {
+            w.WriteJson(1, "ok", b)
+        }
+        return
+    }
+    if b, err := this.node.SendToLeader(gMSG_API_USAGE, gPORT_REPL, nil); err != nil {
+        w.WriteJson(0, err.Error(), nil)
+    } else {
+        w.WriteJson(1, "ok", b)
+    }
+}
@@ -0,0 +1,58 @@
+// 返回格式统一：
+// {result:1, message:"", data:""}
+
+package dister
+
+import (
+    "time"
+    "strconv"
+    "gitee.com/johng/gf/g/net/ghttp"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// K-V 监听(长轮询)
+// 参数：k 键名(prefix为真时表示键名前缀)，prefix 是否按照前缀匹配，logid 调用方最后一次获取到的logid，timeout 等待超时时间(毫秒)
+func (this *NodeApiWatch) Get(s *ghttp.Server, r *ghttp.ClientRequest, w *ghttp.ServerResponse) {
+    k          := r.GetRequestString("k")
+    prefix     := isTrueString(r.GetRequestString("prefix"))
+    logid, _   := strconv.ParseInt(r.GetRequestString("logid"),   10, 64)
+    timeout, _ := strconv.ParseInt(r.GetRequestString("timeout"), 10, 64)
+    if k == "" && !prefix {
+        w.WriteJson(0, "incomplete input: k is required", nil)
+        return
+    }
+    if timeout <= 0 {
+        timeout = gWATCH_TIMEOUT
+    } else if timeout > gWATCH_TIMEOUT_MAX {
+        timeout = gWATCH_TIMEOUT_MAX
+    }
+    if this.node.getRole() != gROLE_SERVER {
+        b, err := this.watchDataFromLeader(k, prefix, logid, timeout)
+        if err != nil {
+            w.WriteJson(0, err.Error(), nil)
+        } else {
+            w.WriteJson(1, "ok", b)
+        }
+    } else {
+        if b, err := gjson.Encode(this.node.watchData(k, prefix, logid, timeout)); err != nil {
+            w.WriteJson(0, err.Error(), nil)
+        } else {
+            w.WriteJson(1, "ok", b)
+        }
+    }
+}
+
+// 通过Leader监听数据变化(client节点不存储数据)
+func (this *NodeApiWatch) watchDataFromLeader(k string, prefix bool, logid int64, timeout int64) ([]byte, error) {
+    b, err := gjson.Encode(map[string]interface{} {
+        "k"       : k,
+        "prefix"  : prefix,
+        "logid"   : logid,
+        "timeout" : timeout,
+    })
+    if err != nil {
+        return nil, err
+    }
+    // 读取超时时间需要在监听超时时间的基础上增加通信的超时时间
+    return this.node.SendToLeaderWithTimeout(gMSG_API_DATA_WATCH, gPORT_REPL, b, time.Duration(timeout + gTCP_READ_TIMEOUT) * time.Millisecond)
+}
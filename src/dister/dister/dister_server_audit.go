@@ -0,0 +1,144 @@
+// 写入审计
+// leader在提交每个LogEntry时记录写入来源(接收请求的节点、客户端IP以及客户端提交的用户与修改原因)，来源随日志一起同步与存储；
+// 审计查询从最新的日志开始逆序检索，找到足够数量的记录或者遇到早于查询时间的写入时停止，只适用于运维排查等低频场景，旧版本写入的日志没有来源信息
+package dister
+
+import (
+    "time"
+    "errors"
+    "strconv"
+    "strings"
+    "gitee.com/johng/gf/g/net/gipv4"
+    "gitee.com/johng/gf/g/net/ghttp"
+)
+
+// 根据HTTP请求生成写入来源，总是记录请求连接的来源IP，只有经过受信任的代理访问时客户端IP才使用X-Forwarded-For请求头
+// 写入持久化级别同样随来源信息一起提交给leader，durability参数优先于X-Dister-Durability请求头
+func (n *Node) makeLogOriginFromRequest(r *ghttp.ClientRequest) *LogOrigin {
+    remote, _ := gipv4.ParseAddress(r.RemoteAddr)
+    durability := r.GetRequestString("durability")
+    if durability == "" {
+        durability = r.Header.Get("X-Dister-Durability")
+    }
+    return &LogOrigin {
+        Node       : n.getId(),
+        Name       : n.getName(),
+        Ip         : n.getClientIp(remote, r.Header.Get("X-Forwarded-For")),
+        Remote     : remote,
+        User       : r.Header.Get("X-Dister-User"),
+        Reason     : r.Header.Get("X-Dister-Reason"),
+        Durability : strings.ToLower(strings.TrimSpace(durability)),
+    }
+}
+
+// 获取请求的客户端IP：请求来自受信任的代理时，从X-Forwarded-For请求头中由右向左跳过受信任的代理，
+// 第一个不受信任的地址即为客户端IP，否则请求头可能是客户端伪造的，直接使用连接的来源IP
+func (n *Node) getClientIp(remote string, forwarded string) string {
+    if forwarded == "" || !containsString(n.TrustedProxies, remote) {
+        return remote
+    }
+    ip   := remote
+    list := strings.Split(forwarded, ",")
+    for i := len(list) - 1; i >= 0; i-- {
+        if v := strings.TrimSpace(list[i]); v != "" {
+            ip = v
+            if !containsString(n.TrustedProxies, v) {
+                break
+            }
+        }
+    }
+    return ip
+}
+
+// 生成leader自身发起的写入的来源(例如键值过期、会话失效)
+func (n *Node) makeLogOrigin(reason string) *LogOrigin {
+    return &LogOrigin {
+        Node   : n.getId(),
+        Name   : n.getName(),
+        Ip     : n.getIp(),
+        Reason : reason,
+    }
+}
+
+// 获取写入请求消息的来源，消息中没有来源信息时(旧版本节点转发的请求)使用发送节点的信息
+func (n *Node) getLogOriginFromMsg(msg *Msg) *LogOrigin {
+    if msg.Origin != nil {
+        origin := *msg.Origin
+        return &origin
+    }
+    return &LogOrigin{Node: msg.Info.Id, Name: msg.Info.Name, Ip: msg.Info.Ip}
+}
+
+// 查询写入审计记录，按照logid升序返回符合条件的最近limit条记录；
+// 从最新的日志开始逆序检索，找到limit条记录或者遇到早于since的写入(写入时间随logid递增，没有来源信息的旧版本日志同样视为更早)时停止
+func (n *Node) getAuditRecords(q *AuditQuery) *AuditResult {
+    if q.Limit <= 0 {
+        q.Limit = gAUDIT_LIMIT
+    } else if q.Limit > gAUDIT_LIMIT_MAX {
+        q.Limit = gAUDIT_LIMIT_MAX
+    }
+    records := make([]AuditRecord, 0)
+    filter  := q.Key != "" || q.Prefix
+    w       := &Watcher{key: q.Key, prefix: q.Prefix}
+    reached := n.walkLogEntriesReverse(func(entry *LogEntry) bool {
+        if q.Since > 0 && (entry.Origin == nil || entry.Origin.Time < q.Since) {
+            return false
+        }
+        events := make([]WatchEvent, 0)
+        for _, e := range n.getWatchEventsFromLogEntry(entry) {
+            if !filter || w.match(e.Key) {
+                events = append(events, e)
+            }
+        }
+        // 指定键名时只返回修改了该键名的写入
+        if filter && len(events) == 0 {
+            return true
+        }
+        records = append(records, AuditRecord{entry.Id, getLogActName(entry.Act), events, entry.Origin})
+        return len(records) < q.Limit
+    })
+    // 逆序检索得到的记录转换为升序
+    for i, j := 0, len(records) - 1; i < j; i, j = i + 1, j - 1 {
+        records[i], records[j] = records[j], records[i]
+    }
+    result := &AuditResult{Records: records}
+    if reached {
+        result.Compacted = n.getCompactLogId()
+    }
+    return result
+}
+
+// 获取LogEntry操作类型的名称
+func getLogActName(act int) string {
+    switch act {
+        case gMSG_REPL_DATA_SET:         return "set"
+        case gMSG_REPL_DATA_REMOVE:      return "remove"
+        case gMSG_REPL_DATA_SET_TTL:     return "set_ttl"
+        case gMSG_REPL_DATA_SET_SESSION: return "set_session"
+        case gMSG_REPL_DATA_TXN:         return "txn"
+        case gMSG_REPL_SESSION_CREATE:   return "session_create"
+        case gMSG_REPL_SESSION_DESTROY:  return "session_destroy"
+        case gMSG_REPL_LOCK_ACQUIRE:     return "lock_acquire"
+        case gMSG_REPL_LOCK_RELEASE:     return "lock_release"
+        case gMSG_REPL_MEMBER_ADD:       return "member_add"
+        case gMSG_REPL_MEMBER_REMOVE:    return "member_remove"
+    }
+    return strconv.Itoa(act)
+}
+
+// 解析审计查询的时间，支持秒/毫秒时间戳以及"2006-01-02 15:04:05"、"2006-01-02"、RFC3339格式的时间，返回毫秒时间戳
+func parseAuditTime(s string) (int64, error) {
+    if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+        // 小于该值的时间戳视为秒
+        if i < 100000000000 {
+            return i*1000, nil
+        }
+        return i, nil
+    }
+    for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02", time.RFC3339} {
+        if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+            return t.UnixNano()/1e6, nil
+        }
+    }
+    return 0, errors.New("invalid time: " + s + ", should be a timestamp, \"2006-01-02 15:04:05\", \"2006-01-02\" or RFC3339 format")
+}
@@ -0,0 +1,72 @@
+package dister
+
+import (
+    "fmt"
+    "testing"
+)
+
+// 只有来自受信任代理的请求才使用X-Forwarded-For请求头中的客户端IP
+func TestGetClientIp(t *testing.T) {
+    n := NewServer()
+    n.TrustedProxies = []string{"10.0.0.1", "10.0.0.2"}
+    cases := []struct {
+        remote    string
+        forwarded string
+        expect    string
+    } {
+        {"192.168.1.1", "",                               "192.168.1.1"},
+        // 不受信任的来源伪造请求头
+        {"192.168.1.1", "1.1.1.1",                        "192.168.1.1"},
+        {"10.0.0.1",    "1.1.1.1",                        "1.1.1.1"},
+        {"10.0.0.1",    "1.1.1.1, 10.0.0.2",              "1.1.1.1"},
+        // 客户端在请求头中伪造的地址位于最左侧，只取最后一个不受信任的地址
+        {"10.0.0.1",    "6.6.6.6, 1.1.1.1, 10.0.0.2",     "1.1.1.1"},
+        {"10.0.0.1",    "10.0.0.2",                       "10.0.0.2"},
+    }
+    for k, v := range cases {
+        if r := n.getClientIp(v.remote, v.forwarded); r != v.expect {
+            t.Errorf("case %d: expect %s, got %s", k, v.expect, r)
+        }
+    }
+}
+
+// 审计查询从最新的日志开始逆序检索，达到limit或者遇到早于since的写入时停止，结果按照logid升序排列
+func TestGetAuditRecords(t *testing.T) {
+    n := NewServer()
+    n.SavePath = "dister_audit_test_nonexistent"
+    for i := int64(1); i <= 5; i++ {
+        k := "a"
+        if i%2 == 0 {
+            k = "b"
+        }
+        n.LogList.PushFront(&LogEntry {
+            Id     : i*gLOGENTRY_RANDOM_ID_SIZE,
+            Act    : gMSG_REPL_DATA_SET,
+            Items  : map[string]interface{}{k: "v"},
+            Origin : &LogOrigin{Time: i*100},
+        })
+        n.setLastLogId(i*gLOGENTRY_RANDOM_ID_SIZE)
+    }
+    cases := []struct {
+        query  AuditQuery
+        expect []int64
+    } {
+        {AuditQuery{},                     []int64{1, 2, 3, 4, 5}},
+        {AuditQuery{Limit: 2},             []int64{4, 5}},
+        {AuditQuery{Since: 300},           []int64{3, 4, 5}},
+        {AuditQuery{Key: "a"},             []int64{1, 3, 5}},
+        {AuditQuery{Key: "a", Limit: 1},   []int64{5}},
+        {AuditQuery{Key: "b", Since: 250}, []int64{4}},
+    }
+    for k, v := range cases {
+        q   := v.query
+        r   := n.getAuditRecords(&q)
+        ids := make([]int64, 0)
+        for _, record := range r.Records {
+            ids = append(ids, record.Id/gLOGENTRY_RANDOM_ID_SIZE)
+        }
+        if fmt.Sprint(ids) != fmt.Sprint(v.expect) {
+            t.Errorf("case %d: expect %v, got %v", k, v.expect, ids)
+        }
+    }
+}
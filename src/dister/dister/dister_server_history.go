@@ -0,0 +1,47 @@
+// KV历史查询
+// 所有的数据变化都按照logid顺序保存在日志文件中，历史查询通过顺序检索日志文件并转换为数据变化事件实现，
+// 因此查询的时间复杂度与日志数量成正比，只适用于运维排查等低频场景
+package dister
+
+// 获取指定键名的数据变化历史，当at>0时只返回该logid(包含)之前的变化
+func (n *Node) getDataHistory(k string, at int64) *KvHistory {
+    history := &KvHistory {
+        Key       : k,
+        Events    : make([]WatchEvent, 0),
+        Compacted : n.getCompactLogId(),
+    }
+    w     := &Watcher{key: k}
+    logid := int64(0)
+    for {
+        list := n.getLogEntriesByLastLogId(logid, 10000, false)
+        if len(list) == 0 {
+            break
+        }
+        for _, v := range list {
+            entry := v
+            // 尚未应用的日志不一定已经提交，不计入历史
+            if (at > 0 && entry.Id > at) || entry.Id > n.getAppliedLogId() {
+                return history
+            }
+            for _, e := range n.getWatchEventsFromLogEntry(&entry) {
+                if w.match(e.Key) {
+                    history.Events = append(history.Events, e)
+                }
+            }
+            logid = entry.Id
+        }
+    }
+    return history
+}
+
+// 根据数据变化历史获取键名在指定logid时的键值，键名在该logid时不存在则返回false
+func (h *KvHistory) valueAt() (string, bool) {
+    if len(h.Events) == 0 {
+        return "", false
+    }
+    e := h.Events[len(h.Events) - 1]
+    if e.Act == "remove" {
+        return "", false
+    }
+    return e.Value, true
+}
@@ -0,0 +1,263 @@
+// 投票成员管理
+// 参与选举投票及多数派计算的server及witness节点(投票成员)通过日志复制进行变更，与DataMap一起存储，
+// 每次只变更一个成员(one-at-a-time)，变更日志使用旧成员表的多数派提交，新旧成员表的多数派必然相交，因此不需要joint consensus；
+// 投票成员表为空表示尚未初始化(旧版本的集群或者新建的集群)，此时所有server节点均为投票成员，leader会提交初始化变更：
+// 配置了Peers时，等待配置中的节点均已加入集群后，以自身及配置中的投票节点初始化；未配置Peers时，等待已知的投票节点数量达到MinNode后初始化，
+// 避免leader以部分节点的视图(例如启动时尚未发现其他节点)初始化投票成员表。
+// 初始化之后通过局域网扫描或者sayHi发现的server节点只作为非投票节点同步数据，需要通过addnode加入投票成员
+package dister
+
+import (
+    "errors"
+    "strings"
+    "gitee.com/johng/gf/g/os/glog"
+    "gitee.com/johng/gf/g/os/gtime"
+    "gitee.com/johng/gf/g/os/gcache"
+)
+
+// 获取投票成员列表(包含自身)
+func (n *Node) getVoters() []Member {
+    list := make([]Member, 0)
+    if n.Voters.Size() > 0 {
+        for _, v := range n.Voters.Values() {
+            list = append(list, v.(Member))
+        }
+        return list
+    }
+    // 投票成员表尚未初始化，所有server及witness节点均为投票成员
+    if isVoterRole(n.getRole()) {
+        list = append(list, Member{n.getId(), n.getName(), n.getIp()})
+    }
+    for _, v := range n.Peers.Values() {
+        if info := v.(NodeInfo); isVoterRole(info.Role) {
+            list = append(list, Member{info.Id, info.Name, info.Ip})
+        }
+    }
+    return list
+}
+
+// 判断节点是否为投票成员
+func (n *Node) isVoter(id string) bool {
+    if n.Voters.Size() > 0 {
+        return n.Voters.Contains(id)
+    }
+    if id == n.getId() {
+        return isVoterRole(n.getRole())
+    }
+    if r := n.Peers.Get(id); r != nil {
+        return isVoterRole(r.(NodeInfo).Role)
+    }
+    return false
+}
+
+// 获取除自身之外的投票成员节点信息，节点表中不存在的成员使用成员表中的信息
+func (n *Node) getVoterPeers() []NodeInfo {
+    list := make([]NodeInfo, 0)
+    for _, m := range n.getVoters() {
+        if m.Id == n.getId() {
+            continue
+        }
+        if r := n.Peers.Get(m.Id); r != nil {
+            list = append(list, r.(NodeInfo))
+        } else {
+            list = append(list, NodeInfo{Id: m.Id, Name: m.Name, Ip: m.Ip, Status: gSTATUS_DEAD})
+        }
+    }
+    return list
+}
+
+// 查找投票成员，node可以是节点ID、名称或者IP
+func (n *Node) findVoter(node string) *Member {
+    for _, m := range n.getVoters() {
+        if m.Id == node || m.Name == node || m.Ip == node {
+            return &m
+        }
+    }
+    return nil
+}
+
+// 获取初始化投票成员表使用的成员列表，返回false表示条件尚未满足
+func (n *Node) getBootstrapVoters() ([]Member, bool) {
+    voters := n.getVoters()
+    n.mutex.RLock()
+    peers  := n.CfgPeers
+    n.mutex.RUnlock()
+    if len(peers) == 0 {
+        if len(voters) < int(n.getMinNode()) {
+            return nil, false
+        }
+        return voters, true
+    }
+    // 配置中的节点需要全部加入集群，才能确定其中哪些是投票节点
+    known := make(map[string]bool)
+    for _, v := range n.Peers.Values() {
+        known[v.(NodeInfo).Ip] = true
+    }
+    for _, ip := range peers {
+        if ip != n.getIp() && !known[ip] {
+            return nil, false
+        }
+    }
+    list := make([]Member, 0, len(peers) + 1)
+    for _, m := range voters {
+        if m.Id == n.getId() || containsString(peers, m.Ip) {
+            list = append(list, m)
+        }
+    }
+    return list, true
+}
+
+// leader初始化投票成员表，force表示由管理员的成员变更操作(addnode/removenode)显式触发，
+// 此时即使初始化条件尚未满足，也以当前已知的投票节点初始化，再执行该次成员变更
+func (n *Node) bootstrapVoters(force bool) {
+    if n.Voters.Size() > 0 || n.getRaftRole() != gROLE_RAFT_LEADER {
+        return
+    }
+    key := "dister_bootstrapping_voters"
+    if gcache.Get(key) != nil {
+        return
+    }
+    gcache.Set(key, struct {}{}, 60000)
+    defer gcache.Remove(key)
+    n.dmutex.Lock()
+    defer n.dmutex.Unlock()
+    if n.Voters.Size() > 0 || n.getRaftRole() != gROLE_RAFT_LEADER {
+        return
+    }
+    voters, ok := n.getBootstrapVoters()
+    if !ok {
+        if !force {
+            return
+        }
+        voters = n.getVoters()
+    }
+    names := make([]string, 0, len(voters))
+    for _, m := range voters {
+        names = append(names, m.Name + "(" + m.Ip + ")")
+    }
+    if entry, ok := n.commitLogEntry(gMSG_REPL_MEMBER_ADD, voters, n.makeLogOrigin("voters bootstrap")); ok {
+        glog.Printfln("voters bootstrapped with %d nodes, logid: %d, voters: %s", len(voters), entry.Id, strings.Join(names, ", "))
+    }
+}
+
+// 提交投票成员变更，调用方需要持有dmutex锁
+func (n *Node) commitMemberChange(act int, items interface{}, origin *LogOrigin) (int64, error) {
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        return 0, errors.New("leadership lost")
+    }
+    // 成员变更总是需要多数派写入成功
+    if origin != nil {
+        origin.Durability = gDURABILITY_QUORUM
+    }
+    entry, ok := n.commitLogEntry(act, items, origin)
+    if !ok {
+        return 0, errors.New("could not commit the change to the majority of voters")
+    }
+    return entry.Id, nil
+}
+
+// 添加投票成员，新节点的日志追上leader之后才提交变更
+func (n *Node) addMember(ip string, origin *LogOrigin) MemberChange {
+    n.bootstrapVoters(true)
+    c := MemberChange{Ip: ip}
+    if m := n.findVoter(ip); m != nil {
+        c.Id, c.Name, c.Result = m.Id, m.Name, "already a voter"
+        return c
+    }
+    // 加入节点表，leader会向其发送心跳并同步数据
+    if !n.Peers.Contains(ip) {
+        glog.Printf("adding peer: %s\n", ip)
+        n.updatePeerInfo(NodeInfo{Id: ip, Ip: ip})
+    }
+    msg, err := n.sendAndReceiveMsgToNode(&NodeInfo{Id: ip, Ip: ip}, gPORT_RAFT, gMSG_RAFT_HI, nil)
+    if err != nil {
+        c.Result = "failed: " + err.Error()
+        return c
+    }
+    info := msg.Info
+    c.Id, c.Name = info.Id, info.Name
+    if !isVoterRole(info.Role) {
+        c.Result = "added as non-voting " + roleName(info.Role)
+        return c
+    }
+    if n.isVoter(info.Id) {
+        c.Result = "already a voter"
+        return c
+    }
+    // 等待新节点的日志追上leader，避免新成员加入后无法及时写入而影响多数派
+    if !n.waitNodeCatchUp(&info, gtime.Millisecond() + gMEMBER_CATCHUP_TIMEOUT) {
+        c.Result = "failed: timeout waiting for the node to catch up with the leader"
+        return c
+    }
+    n.dmutex.Lock()
+    defer n.dmutex.Unlock()
+    logid, err := n.commitMemberChange(gMSG_REPL_MEMBER_ADD, []Member{{info.Id, info.Name, info.Ip}}, origin)
+    if err != nil {
+        c.Result = "failed: " + err.Error()
+        return c
+    }
+    glog.Printfln("voter added: %s(%s), logid: %d", info.Name, info.Ip, logid)
+    c.LogId, c.Result = logid, "voter added"
+    return c
+}
+
+// 删除投票成员，node可以是节点ID、名称或者IP，leader自身需要先转移leader
+func (n *Node) removeMember(node string, origin *LogOrigin) MemberChange {
+    n.bootstrapVoters(true)
+    c := MemberChange{Ip: node}
+    m := n.findVoter(node)
+    if m == nil {
+        // 非投票节点直接从节点表中删除
+        for _, v := range n.Peers.Values() {
+            if info := v.(NodeInfo); info.Id == node || info.Name == node || info.Ip == node {
+                glog.Printf("removing peer: %s, ip: %s\n", info.Name, info.Ip)
+                n.Peers.Remove(info.Id)
+                c.Id, c.Name, c.Ip, c.Result = info.Id, info.Name, info.Ip, "non-voting peer removed"
+                return c
+            }
+        }
+        c.Result = "failed: node not found"
+        return c
+    }
+    c.Id, c.Name, c.Ip = m.Id, m.Name, m.Ip
+    if m.Id == n.getId() {
+        c.Result = "failed: cannot remove the leader, please transfer leadership first"
+        return c
+    }
+    n.dmutex.Lock()
+    logid, err := n.commitMemberChange(gMSG_REPL_MEMBER_REMOVE, []string{m.Id}, origin)
+    n.dmutex.Unlock()
+    if err != nil {
+        c.Result = "failed: " + err.Error()
+        return c
+    }
+    glog.Printfln("voter removed: %s(%s), logid: %d", m.Name, m.Ip, logid)
+    n.Peers.Remove(m.Id)
+    c.LogId, c.Result = logid, "voter removed"
+    return c
+}
+
+// 执行投票成员变更日志
+func (n *Node) applyMemberChange(entry *LogEntry) {
+    switch entry.Act {
+        case gMSG_REPL_MEMBER_ADD:
+            list := make([]Member, 0)
+            if err := n.decodeLogEntryItems(entry, &list); err != nil {
+                glog.Error(err)
+                return
+            }
+            for _, m := range list {
+                n.Voters.Set(m.Id, m)
+            }
+
+        case gMSG_REPL_MEMBER_REMOVE:
+            list := make([]string, 0)
+            if err := n.decodeLogEntryItems(entry, &list); err != nil {
+                glog.Error(err)
+                return
+            }
+            for _, id := range list {
+                n.Voters.Remove(id)
+            }
+    }
+}
@@ -0,0 +1,37 @@
+package dister
+
+import (
+    "testing"
+)
+
+// 投票成员表的初始化成员：配置了Peers时等待配置中的节点全部加入，只使用配置中的投票节点；否则需要达到MinNode
+func TestGetBootstrapVoters(t *testing.T) {
+    n := NewServer()
+    n.Ip = "10.0.0.1"
+    n.setMinNode(3)
+    n.Peers.Set("B", NodeInfo{Id: "B", Name: "B", Ip: "10.0.0.2", Role: gROLE_SERVER})
+    if _, ok := n.getBootstrapVoters(); ok {
+        t.Error("should wait until MinNode voters are known")
+    }
+    n.Peers.Set("C", NodeInfo{Id: "C", Name: "C", Ip: "10.0.0.3", Role: gROLE_WITNESS})
+    n.Peers.Set("D", NodeInfo{Id: "D", Name: "D", Ip: "10.0.0.4", Role: gROLE_CLIENT})
+    if voters, ok := n.getBootstrapVoters(); !ok || len(voters) != 3 {
+        t.Errorf("unexpected voters: %v, %v", voters, ok)
+    }
+
+    n.CfgPeers = []string{"10.0.0.1", "10.0.0.2", "10.0.0.4", "10.0.0.5"}
+    if _, ok := n.getBootstrapVoters(); ok {
+        t.Error("should wait until all configured peers are known")
+    }
+    n.Peers.Set("E", NodeInfo{Id: "E", Name: "E", Ip: "10.0.0.5", Role: gROLE_SERVER})
+    voters, ok := n.getBootstrapVoters()
+    if !ok || len(voters) != 3 {
+        t.Fatalf("unexpected voters: %v, %v", voters, ok)
+    }
+    // 未配置的节点C及非投票角色的节点D不是初始投票成员
+    for _, m := range voters {
+        if m.Id == "C" || m.Id == "D" {
+            t.Errorf("unexpected voter: %v", m)
+        }
+    }
+}
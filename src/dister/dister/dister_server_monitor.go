@@ -0,0 +1,296 @@
+// 集群监控(monitor节点)
+// monitor节点不参与选举也不存储数据，定期向集群中的各节点发送HI消息进行探测，根据消息头中的节点信息记录集群的变化：
+// leader变更(包括任期变化)、节点存活状态变更、server节点的日志复制延迟以及服务健康状态变更(服务数据由leader同步到monitor节点的内存中)；
+// 变化事件以及每次探测的采样保存在内存中的滚动历史中，超过上限时丢弃最旧的记录，
+// 通过本地API的/monitor接口以及monitor节点独立的只读监控接口(gPORT_MONITOR，可在运维网络中访问)查询
+package dister
+
+import (
+    "fmt"
+    "sync"
+    "time"
+    "gitee.com/johng/gf/g/os/glog"
+    "gitee.com/johng/gf/g/os/gtime"
+)
+
+// 监控探测的上一次观察结果，用于发现变化
+type monitorState struct {
+    leader   string            // leader节点ID
+    term     int64
+    peers    map[string]string // 节点ID->存活状态
+    names    map[string]string // 节点ID->节点名称
+    lagging  map[string]bool   // 复制延迟超过警戒值的server节点ID
+    services map[string]string // 服务节点键名->健康状态
+}
+
+// monitor节点的集群监控循环
+func (n *Node) monitorHandler() {
+    if n.getRole() != gROLE_MONITOR {
+        return
+    }
+    state := &monitorState {
+        peers    : make(map[string]string),
+        names    : make(map[string]string),
+        lagging  : make(map[string]bool),
+        services : make(map[string]string),
+    }
+    for {
+        list   := n.probePeers()
+        leader := n.findLeaderFromProbes(list)
+        n.checkMonitorLeader(state, leader)
+        n.checkMonitorPeers(state, list)
+        n.addMonitorSample(n.checkMonitorLags(state, leader, list))
+        n.checkMonitorServices(state)
+        time.Sleep(gMONITOR_INTERVAL * time.Millisecond)
+    }
+}
+
+// 并发探测所有节点，返回各节点最新的节点信息，无法连通的节点状态为dead
+func (n *Node) probePeers() []NodeInfo {
+    peers := n.Peers.Values()
+    list  := make([]NodeInfo, len(peers))
+    wg    := sync.WaitGroup{}
+    for i, v := range peers {
+        wg.Add(1)
+        go func(i int, info NodeInfo) {
+            defer wg.Done()
+            if msg, err := n.sendAndReceiveMsgToNode(&info, gPORT_RAFT, gMSG_RAFT_HI, nil); err == nil {
+                info        = msg.Info
+                info.Status = gSTATUS_ALIVE
+            } else {
+                info.Status = gSTATUS_DEAD
+                n.updatePeerStatus(info.Id, gSTATUS_DEAD)
+            }
+            list[i] = info
+        }(i, v.(NodeInfo))
+    }
+    wg.Wait()
+    return list
+}
+
+// 从探测结果中查找leader，存在多个leader(例如旧leader尚未退位)时以任期最高的为准
+func (n *Node) findLeaderFromProbes(list []NodeInfo) *NodeInfo {
+    var leader *NodeInfo
+    for i, info := range list {
+        if info.Status != gSTATUS_ALIVE || info.RaftRole != gROLE_RAFT_LEADER {
+            continue
+        }
+        if leader == nil || info.Term > leader.Term {
+            leader = &list[i]
+        }
+    }
+    return leader
+}
+
+// 记录leader变更
+func (n *Node) checkMonitorLeader(state *monitorState, leader *NodeInfo) {
+    id, term := "", int64(0)
+    if leader != nil {
+        id, term = leader.Id, leader.Term
+    }
+    if id == state.leader && (id == "" || term == state.term) {
+        return
+    }
+    from, to := state.names[state.leader], ""
+    detail   := "leader lost"
+    if leader != nil {
+        to     = leader.Name
+        detail = fmt.Sprintf("term %d", term)
+    }
+    n.addMonitorEvent("leader", to, from, to, detail)
+    state.leader, state.term = id, term
+}
+
+// 记录节点存活状态变更、新增及删除的节点
+func (n *Node) checkMonitorPeers(state *monitorState, list []NodeInfo) {
+    current := make(map[string]bool)
+    for _, info := range list {
+        status := "dead"
+        if info.Status == gSTATUS_ALIVE {
+            status = "alive"
+        }
+        current[info.Id] = true
+        if info.Name != "" {
+            state.names[info.Id] = info.Name
+        }
+        name := state.names[info.Id]
+        if name == "" {
+            name = info.Ip
+        }
+        if old, ok := state.peers[info.Id]; !ok {
+            n.addMonitorEvent("peer", name, "", status, fmt.Sprintf("%s %s", roleName(info.Role), info.Ip))
+        } else if old != status {
+            n.addMonitorEvent("peer", name, old, status, fmt.Sprintf("%s %s", roleName(info.Role), info.Ip))
+        }
+        state.peers[info.Id] = status
+    }
+    for id, status := range state.peers {
+        if !current[id] {
+            n.addMonitorEvent("peer", state.names[id], status, "removed", "")
+            delete(state.peers, id)
+            delete(state.lagging, id)
+        }
+    }
+}
+
+// 计算各server节点的日志复制延迟，超过或者恢复到警戒值以内时记录事件，返回本次的采样
+func (n *Node) checkMonitorLags(state *monitorState, leader *NodeInfo, list []NodeInfo) MonitorSample {
+    sample := MonitorSample {
+        Time  : gtime.Millisecond(),
+        Total : len(list),
+        Lags  : make(map[string]int64),
+    }
+    for _, info := range list {
+        if info.Status == gSTATUS_ALIVE {
+            sample.Alive++
+        }
+    }
+    if leader == nil {
+        return sample
+    }
+    sample.Leader      = leader.Name
+    sample.Term        = leader.Term
+    sample.LastLogId   = leader.LastLogId
+    sample.CommitLogId = leader.CommitLogId
+    for _, info := range list {
+        if info.Role != gROLE_SERVER || info.Status != gSTATUS_ALIVE || info.Id == leader.Id {
+            continue
+        }
+        // logid的高位为日志序号，因此两者高位的差值即为落后的日志数量
+        lag := leader.LastLogId/gLOGENTRY_RANDOM_ID_SIZE - info.LastLogId/gLOGENTRY_RANDOM_ID_SIZE
+        if lag < 0 {
+            lag = 0
+        }
+        sample.Lags[info.Name] = lag
+        if lag > gMONITOR_LAG_WARNING && !state.lagging[info.Id] {
+            n.addMonitorEvent("lag", info.Name, "normal", "lagging", fmt.Sprintf("%d entries behind the leader", lag))
+            state.lagging[info.Id] = true
+        } else if lag <= gMONITOR_LAG_WARNING && state.lagging[info.Id] {
+            n.addMonitorEvent("lag", info.Name, "lagging", "normal", fmt.Sprintf("%d entries behind the leader", lag))
+            delete(state.lagging, info.Id)
+        }
+    }
+    return sample
+}
+
+// 记录服务健康状态变更
+func (n *Node) checkMonitorServices(state *monitorState) {
+    current := make(map[string]bool)
+    for k, v := range n.getServiceListForCheck() {
+        status := "unknown"
+        if r, ok := v.Node["status"]; ok {
+            // 无论状态是int还是float64，这里统一转换为字符串进行比较
+            switch fmt.Sprintf("%v", r) {
+                case "0": status = "unhealthy"
+                case "1": status = "healthy"
+            }
+        }
+        current[k] = true
+        if old, ok := state.services[k]; ok && old != status {
+            n.addMonitorEvent("service", k, old, status, getServiceNodeAddress(v))
+        }
+        state.services[k] = status
+    }
+    for k, status := range state.services {
+        if !current[k] {
+            n.addMonitorEvent("service", k, status, "removed", "")
+            delete(state.services, k)
+        }
+    }
+}
+
+// 获取服务节点的地址，用于监控事件的描述
+func getServiceNodeAddress(s Service) string {
+    if url, ok := s.Node["url"]; ok {
+        return fmt.Sprintf("%v", url)
+    }
+    host, _ := s.Node["host"]
+    port, _ := s.Node["port"]
+    if host != nil {
+        return fmt.Sprintf("%s %v:%v", s.Type, host, port)
+    }
+    return s.Type
+}
+
+// 添加监控事件，超过上限时丢弃最旧的事件
+func (n *Node) addMonitorEvent(t, node, from, to, detail string) {
+    glog.Printfln("monitor %s event: %s, %s -> %s %s", t, node, from, to, detail)
+    n.mmutex.Lock()
+    n.MonitorEvents = append(n.MonitorEvents, MonitorEvent{gtime.Millisecond(), t, node, from, to, detail})
+    if len(n.MonitorEvents) > gMONITOR_EVENTS_MAX {
+        n.MonitorEvents = n.MonitorEvents[len(n.MonitorEvents) - gMONITOR_EVENTS_MAX:]
+    }
+    n.mmutex.Unlock()
+}
+
+// 添加周期采样，超过上限时丢弃最旧的采样
+func (n *Node) addMonitorSample(sample MonitorSample) {
+    n.mmutex.Lock()
+    n.MonitorSamples = append(n.MonitorSamples, sample)
+    if len(n.MonitorSamples) > gMONITOR_SAMPLES_MAX {
+        n.MonitorSamples = n.MonitorSamples[len(n.MonitorSamples) - gMONITOR_SAMPLES_MAX:]
+    }
+    n.mmutex.Unlock()
+}
+
+// 查询监控历史，事件及采样按照时间升序返回符合条件的最近limit条记录
+func (n *Node) getMonitorReport(q *MonitorQuery) *MonitorReport {
+    if q.Limit <= 0 {
+        q.Limit = gMONITOR_LIMIT
+    } else if q.Limit > gMONITOR_LIMIT_MAX {
+        q.Limit = gMONITOR_LIMIT_MAX
+    }
+    report := &MonitorReport {
+        Peers   : make([]NodeInfo, 0),
+        Events  : make([]MonitorEvent, 0),
+        Samples : make([]MonitorSample, 0),
+    }
+    for _, v := range n.Peers.Values() {
+        report.Peers = append(report.Peers, v.(NodeInfo))
+    }
+    n.mmutex.RLock()
+    defer n.mmutex.RUnlock()
+    for i := len(n.MonitorEvents) - 1; i >= 0 && len(report.Events) < q.Limit; i-- {
+        e := n.MonitorEvents[i]
+        if e.Time < q.Since {
+            break
+        }
+        if q.Type == "" || q.Type == e.Type {
+            report.Events = append(report.Events, e)
+        }
+    }
+    for i := len(n.MonitorSamples) - 1; i >= 0 && len(report.Samples) < q.Limit; i-- {
+        if n.MonitorSamples[i].Time < q.Since {
+            break
+        }
+        report.Samples = append(report.Samples, n.MonitorSamples[i])
+    }
+    if length := len(n.MonitorSamples); length > 0 {
+        sample       := n.MonitorSamples[length - 1]
+        report.Status = &sample
+    }
+    reverseMonitorEvents(report.Events)
+    reverseMonitorSamples(report.Samples)
+    return report
+}
+
+func reverseMonitorEvents(list []MonitorEvent) {
+    for i, j := 0, len(list) - 1; i < j; i, j = i + 1, j - 1 {
+        list[i], list[j] = list[j], list[i]
+    }
+}
+
+func reverseMonitorSamples(list []MonitorSample) {
+    for i, j := 0, len(list) - 1; i < j; i, j = i + 1, j - 1 {
+        list[i], list[j] = list[j], list[i]
+    }
+}
+
+// 判断监控事件类型是否有效，为空表示所有类型
+func isValidMonitorEventType(t string) bool {
+    switch t {
+        case "", "leader", "peer", "lag", "service":
+            return true
+    }
+    return false
+}
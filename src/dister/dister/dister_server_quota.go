@@ -0,0 +1,99 @@
+// K-V配额
+// 数据总字节数在键值写入内存时增量维护，配额由leader在提交写入前(持有dmutex锁)检查，
+// 超出配额的写入直接返回错误信息，不会写入日志；配额调小后已经超出配额的数据不受影响，但只允许不增加用量的写入
+package dister
+
+import (
+    "fmt"
+    "net"
+    "errors"
+    "sync/atomic"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// 写入键值，并更新数据总字节数
+func (n *Node) setData(k string, v string) {
+    if n.DataMap.Contains(k) {
+        atomic.AddInt64(&n.DataSize, int64(len(v) - len(n.DataMap.Get(k))))
+    } else {
+        atomic.AddInt64(&n.DataSize, int64(len(k) + len(v)))
+    }
+    n.DataMap.Set(k, v)
+}
+
+// 删除键值，并更新数据总字节数
+func (n *Node) removeData(k string) {
+    if n.DataMap.Contains(k) {
+        atomic.AddInt64(&n.DataSize, -int64(len(k) + len(n.DataMap.Get(k))))
+        n.DataMap.Remove(k)
+    }
+}
+
+// 根据DataMap重新计算数据总字节数
+func (n *Node) resetDataSize() {
+    size := int64(0)
+    for k, v := range *n.DataMap.Clone() {
+        size += int64(len(k) + len(v))
+    }
+    atomic.StoreInt64(&n.DataSize, size)
+}
+
+// 获取数据总字节数
+func (n *Node) getDataSize() int64 {
+    return atomic.LoadInt64(&n.DataSize)
+}
+
+// 检查写入是否超出配额，set为设置的键值，remove为同时删除的键名，调用方需要持有dmutex锁
+func (n *Node) checkKvQuota(set map[string]string, remove []string) error {
+    q := n.Quota
+    for k, v := range set {
+        if q.MaxKeyLength > 0 && len(k) > q.MaxKeyLength {
+            return errors.New(fmt.Sprintf("key length %d exceeds the limit %d: %s", len(k), q.MaxKeyLength, k))
+        }
+        if q.MaxValueSize > 0 && len(v) > q.MaxValueSize {
+            return errors.New(fmt.Sprintf("value size %d exceeds the limit %d, key: %s", len(v), q.MaxValueSize, k))
+        }
+    }
+    if q.MaxKeys == 0 && q.MaxDataSize == 0 {
+        return nil
+    }
+    // 计算写入后的键值数量及数据总字节数的变化
+    keys := 0
+    size := int64(0)
+    for _, k := range remove {
+        if _, ok := set[k]; !ok && n.DataMap.Contains(k) {
+            keys--
+            size -= int64(len(k) + len(n.DataMap.Get(k)))
+        }
+    }
+    for k, v := range set {
+        if n.DataMap.Contains(k) {
+            size += int64(len(v) - len(n.DataMap.Get(k)))
+        } else {
+            keys++
+            size += int64(len(k) + len(v))
+        }
+    }
+    if total := n.DataMap.Size() + keys; q.MaxKeys > 0 && keys > 0 && total > q.MaxKeys {
+        return errors.New(fmt.Sprintf("key count quota exceeded: %d keys after writing, limit %d", total, q.MaxKeys))
+    }
+    if total := n.getDataSize() + size; q.MaxDataSize > 0 && size > 0 && total > q.MaxDataSize {
+        return errors.New(fmt.Sprintf("data size quota exceeded: %d bytes after writing, limit %d", total, q.MaxDataSize))
+    }
+    return nil
+}
+
+// 获取K-V用量
+func (n *Node) getKvUsage() *KvUsage {
+    return &KvUsage {
+        Keys     : n.DataMap.Size(),
+        DataSize : n.getDataSize(),
+        Quota    : n.Quota,
+    }
+}
+
+// 用于API接口的K-V用量查询，由leader返回
+func (n *Node) onMsgApiUsage(conn net.Conn, msg *Msg) {
+    b, _ := gjson.Encode(n.getKvUsage())
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
+}
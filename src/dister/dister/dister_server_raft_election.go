@@ -12,25 +12,39 @@ import (
 // 改进：
 // 3个节点以内的集群也可以完成leader选举
 func (n *Node) electionHandler() {
+    // raft选举模式下启动时先等待一个随机的选举超时时间，优先接受已有leader的心跳
+    if n.isRaftElection() {
+        n.updateElectionDeadline()
+    }
     for {
-        if n.getRole() == gROLE_SERVER && n.getRaftRole() != gROLE_RAFT_LEADER && gtime.Millisecond() >= n.getElectionDeadline() {
+        // 只有投票成员才能发起选举，非投票的server节点只同步数据，存在优先级更高的投票成员时额外等待
+        if n.getRole() == gROLE_SERVER && n.isVoter(n.getId()) && n.getRaftRole() != gROLE_RAFT_LEADER &&
+            gtime.Millisecond() >= n.getElectionDeadline() + n.getElectionPriorityDelay() {
             // 使用MinNode变量控制最小节点数(这里判断的时候要去除自身的数量)
             if n.Peers.Size() >= int(n.getMinNode() - 1) {
-                if n.Peers.Size() > 0 {
+                if n.isQuorumCheckEnabled() && !n.preVote() {
+                    // 无法获得多数派的预投票(例如节点被网络隔离、leader仍然存活)，不发起选举，等待下一个选举超时
+                    n.updateElectionDeadline()
+                } else if n.isRaftElection() {
+                    n.beginRaftElection()
+                } else if n.Peers.Size() > 0 {
                     // 集群是2个节点及以上
                     n.resetAsCandidate()
                     n.beginScore()
                 } else {
                     // 集群目前仅有1个节点
                     //glog.Println("only one node in this cluster, i'll be the leader")
-                    n.setLeader(n.getNodeInfo())
-                    n.setRaftRole(gROLE_RAFT_LEADER)
+                    n.becomeScoreLeader()
                 }
             } else {
                 //glog.Println("no meet the least nodes count:", n.MinNode, ", current:", n.Peers.Size() + 1)
             }
         }
-        time.Sleep(500 * time.Millisecond)
+        if n.isRaftElection() {
+            time.Sleep(gELECTION_CHECK_INTERVAL * time.Millisecond)
+        } else {
+            time.Sleep(500 * time.Millisecond)
+        }
     }
 }
 
@@ -39,10 +53,10 @@ func (n *Node) beginScore() {
     glog.Debug("new election...")
     // 请求比分数据
     n.broadcastRequestingScoreRequest()
-    // 必需要获得多数派(n/2+1)比分（以保证能够连通绝大部分的节点）才能满足leader的基础条件
-    // 注意这里的ScoreCount和n.Peers.Size都不包含自身
+    // 必需要获得多数派(n/2+1)投票成员的比分（以保证能够连通绝大部分的节点）才能满足leader的基础条件
+    // 注意这里的ScoreCount不包含自身
     scoreCount := n.getScoreCount() + 1
-    leastCount := int((n.Peers.Size() + 1)/2) + 1
+    leastCount := n.getQuorumCount()
     if scoreCount < int32(leastCount) {
         n.updateElectionDeadline()
         //glog.Printf("election failed: could not reach major of the nodes, score count:%d, group size:%d\n", scoreCount, n.Peers.Size() + 1)
@@ -56,8 +70,7 @@ func (n *Node) beginScore() {
     // 判断是否选举失败
     if !n.checkFailedTheElection() {
         //glog.Println("won the score comparison, become the leader")
-        n.setLeader(n.getNodeInfo())
-        n.setRaftRole(gROLE_RAFT_LEADER)
+        n.becomeScoreLeader()
     }
 }
 
@@ -105,7 +118,9 @@ func (n *Node) broadcastRequestingScoreRequest() {
                         etime := time.Now().UnixNano()
                         score := etime - stime
                         n.addScore(score)
-                        n.addScoreCount()
+                        if n.isVoter(info.Id) {
+                            n.addScoreCount()
+                        }
                 }
             } else {
                 n.updatePeerStatus(info.Id, gSTATUS_DEAD)
@@ -13,6 +13,11 @@ func (n *Node) raftTcpHandler(conn net.Conn) {
         conn.Close()
         return
     }
+    // 拒绝任期过期的消息
+    if n.rejectStaleTermMsg(conn, msg, gMSG_RAFT_TERM_EXPIRED) {
+        n.raftTcpHandler(conn)
+        return
+    }
 
     // 消息处理
     switch msg.Head {
@@ -22,6 +27,10 @@ func (n *Node) raftTcpHandler(conn net.Conn) {
         case gMSG_RAFT_SCORE_COMPARE_REQUEST:   n.onMsgRaftScoreCompareRequest(conn, msg)
         case gMSG_RAFT_LEADER_COMPARE_REQUEST:  n.onMsgRaftLeaderCompareRequest(conn, msg)
         case gMSG_RAFT_SPLIT_BRAINS_CHECK:      n.onMsgRaftSplitBrainsCheck(conn, msg)
+        case gMSG_RAFT_VOTE_REQUEST:            n.onMsgRaftVoteRequest(conn, msg)
+        case gMSG_RAFT_TIMEOUT_NOW:             n.onMsgRaftTimeoutNow(conn, msg)
+        case gMSG_RAFT_PREVOTE_REQUEST:         n.onMsgRaftPreVoteRequest(conn, msg)
+        case gMSG_RAFT_LEADER_CONFIRM_REQUEST:  n.onMsgRaftLeaderConfirmRequest(conn, msg)
     }
     // 链接不再使用时务必在客户端进行关闭，防止链接数超过系统限制
     // 此外由于链接有读取超时，当一段时间没有数据时也会自动关闭，但是在并发量大时，未手动关闭链接同样有链接数限制问题
@@ -33,6 +42,17 @@ func (n *Node) onMsgRaftHi(conn net.Conn, msg *Msg) {
     n.sendMsg(conn, gMSG_RAFT_HI2, nil)
 }
 
+// leader身份确认(只读探测)，用于一致性读取，不会像心跳一样更新leader、选举超时等任何节点状态，
+// 只有本节点在相同任期内承认发送方为leader时才返回确认
+func (n *Node) onMsgRaftLeaderConfirmRequest(conn net.Conn, msg *Msg) {
+    result := gMSG_RAFT_LEADER_CONFIRM_FAILURE
+    leader := n.getLeader()
+    if leader != nil && leader.Id == msg.Info.Id && n.getRaftRole() != gROLE_RAFT_LEADER && msg.Info.Term == n.getCurrentTerm() {
+        result = gMSG_RAFT_LEADER_CONFIRM_SUCCESS
+    }
+    n.sendMsg(conn, result, nil)
+}
+
 // RAFT协议心跳保持，用以维系RAFT集群统治，保证集群各节点的角色状态
 // 接收leader的心跳消息处理
 func (n *Node) onMsgRaftHeartbeat(conn net.Conn, msg *Msg) {
@@ -41,6 +61,11 @@ func (n *Node) onMsgRaftHeartbeat(conn net.Conn, msg *Msg) {
         conn.Close()
         return
     }
+    // raft选举模式下由任期决定leader，不需要比较leader及处理脑裂
+    if n.isRaftElection() {
+        n.onMsgRaftTermHeartbeat(conn, msg)
+        return
+    }
     result := gMSG_RAFT_HEARTBEAT
     if n.getRaftRole() == gROLE_RAFT_LEADER {
         // 如果是两个leader相互心跳，表示两个leader是连通的，这时根据算法算出一个leader即可
@@ -143,7 +168,7 @@ func (n *Node) onMsgRaftScoreCompareRequest(conn net.Conn, msg *Msg) {
     if n.getRaftRole() == gROLE_RAFT_LEADER && n.getLastLogId() >= msg.Info.LastLogId {
         result = gMSG_RAFT_I_AM_LEADER
     } else {
-        if n.compareLeaderWithRemoteNodeByDetail(msg.Info.LastLogId, int32(j.GetInt("count")), j.GetInt64("score")) {
+        if n.compareLeaderWithRemoteNodeByDetail(msg.Info.LastLogId, msg.Info.LeaderPriority, int32(j.GetInt("count")), j.GetInt64("score")) {
             result = gMSG_RAFT_SCORE_COMPARE_FAILURE
         } else {
             // 只是更新选举超时时间，最终leader的确定靠首次leader心跳
@@ -160,7 +185,7 @@ func (n *Node) onMsgRaftLeaderCompareRequest(conn net.Conn, msg *Msg) {
         return
     }
     result := gMSG_RAFT_LEADER_COMPARE_SUCCESS
-    if n.compareLeaderWithRemoteNodeByDetail(msg.Info.LastLogId, int32(j.GetInt("count")), j.GetInt64("score")) {
+    if n.compareLeaderWithRemoteNodeByDetail(msg.Info.LastLogId, msg.Info.LeaderPriority, int32(j.GetInt("count")), j.GetInt64("score")) {
         result = gMSG_RAFT_LEADER_COMPARE_FAILURE
     }
     n.sendMsg(conn, result, nil)
@@ -3,6 +3,7 @@ package dister
 import (
     "time"
     "gitee.com/johng/gf/g/os/glog"
+    "gitee.com/johng/gf/g/os/gtime"
     "gitee.com/johng/gf/g/container/gset"
 )
 
@@ -13,6 +14,19 @@ func (n *Node) heartbeatHandler() {
     conns := gset.NewStringSet()
     for {
         if n.getRaftRole() == gROLE_RAFT_LEADER {
+            // 一个选举超时时间内无法获得多数派的心跳回复，那么主动退回follower，
+            // 避免被网络隔离在少数派一侧的leader继续提供服务(2个节点的score集群不做该检查)
+            if n.isQuorumCheckEnabled() {
+                n.checkQuorum()
+            }
+            // 心跳回复会更新各节点的LastLogId，以此推进已提交logid(包括异步同步的写入)
+            n.updateCommitLogId()
+            // 应用成为leader之前尚未应用的日志
+            n.applyCommittedLogEntriesAsync()
+            // 投票成员表尚未初始化时由leader提交初始化变更
+            if n.Voters.Size() == 0 {
+                go n.bootstrapVoters(false)
+            }
             for _, v := range n.Peers.Values() {
                 info := v.(NodeInfo)
                 if conns.Contains(info.Id) {
@@ -60,6 +74,15 @@ func (n *Node) heartbeatHandler() {
                                     glog.Println("split brains occurred, remove node:", msg.Info.Name)
                                     n.Peers.Remove(msg.Info.Id)
 
+                                // 节点的任期更高，表示已经产生了新的leader，接收消息时已经退回follower
+                                case gMSG_RAFT_TERM_EXPIRED:
+                                    glog.Printfln("term expired, got higher term %d from %s, done heartbeating", msg.Info.Term, msg.Info.Name)
+
+                                // 节点接受了leader的统治，记录回复时间用于check-quorum
+                                case gMSG_RAFT_HEARTBEAT:
+                                    n.HeartbeatAcks.Set(id, gtime.Millisecond())
+                                    time.Sleep(gELECTION_TIMEOUT_HEARTBEAT * time.Millisecond)
+
                                 default:
                                     time.Sleep(gELECTION_TIMEOUT_HEARTBEAT * time.Millisecond)
                             }
@@ -71,3 +94,39 @@ func (n *Node) heartbeatHandler() {
         time.Sleep(gELECTION_TIMEOUT_HEARTBEAT * time.Millisecond)
     }
 }
+
+// leader通过向存活的投票成员发送只读的身份确认探测，确认自身仍然是集群的leader，获得多数派(包含自身)的确认即返回，
+// 不等待其余节点的回复；用于一致性读取，防止已经失去统治的旧leader返回过期的数据
+func (n *Node) confirmLeadership() bool {
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        return false
+    }
+    quorum := n.getQuorumCount()
+    if quorum <= 1 {
+        return true
+    }
+    peers := make([]NodeInfo, 0)
+    for _, v := range n.getVoterPeers() {
+        // 已宕机的节点无法确认，跳过以免等待连接超时
+        if v.Status == gSTATUS_ALIVE {
+            peers = append(peers, v)
+        }
+    }
+    if len(peers) + 1 < quorum {
+        return false
+    }
+    result := make(chan bool, len(peers))
+    for _, v := range peers {
+        go func(info NodeInfo) {
+            msg, err := n.sendAndReceiveMsgToNode(&info, gPORT_RAFT, gMSG_RAFT_LEADER_CONFIRM_REQUEST, nil)
+            result <- err == nil && msg.Head == gMSG_RAFT_LEADER_CONFIRM_SUCCESS
+        }(v)
+    }
+    acks := 1 // 包含自身
+    for i := 0; i < len(peers) && acks < quorum; i++ {
+        if <-result {
+            acks++
+        }
+    }
+    return acks >= quorum && n.getRaftRole() == gROLE_RAFT_LEADER
+}
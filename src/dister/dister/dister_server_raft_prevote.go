@@ -0,0 +1,73 @@
+// 预投票(pre-vote)及check-quorum(raft选举模式下始终启用；score选举模式下投票成员不少于3个时启用，
+// 2个节点的score集群保持原有的选举流程，以便在一个节点故障时仍然能够完成切换)
+// 节点在选举超时之后先向其他server节点发送预投票请求，只有多数派(包含自身)愿意接受其成为leader时才真正发起选举，
+// 预投票不改变任何节点的任期及状态，因此被网络隔离的节点重新加入集群时不会打断现有leader的统治；
+// 节点在最近一个选举超时时间内收到过leader心跳(或者自身就是leader)时拒绝预投票，日志比自身旧的节点同样被拒绝。
+// leader在一个选举超时时间内无法获得多数派server节点的心跳回复时主动退回follower，避免被隔离的旧leader继续提供服务
+package dister
+
+import (
+    "net"
+    "sync/atomic"
+    "gitee.com/johng/gf/g/os/glog"
+    "gitee.com/johng/gf/g/os/gtime"
+)
+
+// 判断是否启用预投票及check-quorum：raft选举模式始终启用，score选举模式下多数派能够容忍一个节点故障(投票成员不少于3个)时启用
+func (n *Node) isQuorumCheckEnabled() bool {
+    return n.isRaftElection() || len(n.getVoters()) >= 3
+}
+
+// 向其他server节点发送预投票请求，获得多数派(包含自身)的预投票时返回true
+func (n *Node) preVote() bool {
+    quorum := n.getQuorumCount()
+    if quorum <= 1 {
+        return true
+    }
+    count := n.requestVotes(gMSG_RAFT_PREVOTE_REQUEST, gMSG_RAFT_PREVOTE_GRANTED)
+    if count < quorum {
+        glog.Debugfln("pre-vote failed, votes: %d, quorum: %d", count, quorum)
+        return false
+    }
+    // 预投票期间可能已经收到了leader的心跳
+    return n.getLeader() == nil || n.getRaftRole() != gROLE_RAFT_FOLLOWER || gtime.Millisecond() >= n.getElectionDeadline()
+}
+
+// 预投票请求处理，不改变自身的任期及状态
+func (n *Node) onMsgRaftPreVoteRequest(conn net.Conn, msg *Msg) {
+    result := gMSG_RAFT_PREVOTE_GRANTED
+    if !isVoterRole(n.getRole()) || msg.Info.Role != gROLE_SERVER || !n.isVoter(msg.Info.Id) {
+        result = gMSG_RAFT_PREVOTE_REJECTED
+    } else if n.getRaftRole() == gROLE_RAFT_LEADER {
+        // 自身是leader，并且通过check-quorum保证仍然能够连通多数派
+        result = gMSG_RAFT_PREVOTE_REJECTED
+    } else if n.getLeader() != nil && gtime.Millisecond() < n.getElectionDeadline() {
+        // 最近一个选举超时时间内收到过leader的心跳
+        result = gMSG_RAFT_PREVOTE_REJECTED
+    } else if msg.Info.Term < n.getCurrentTerm() || !n.isLogUpToDate(getLastLogTermFromMsg(msg), msg.Info.LastLogId) {
+        result = gMSG_RAFT_PREVOTE_REJECTED
+    }
+    n.sendMsg(conn, result, nil)
+}
+
+// leader检查最近一个选举超时时间内是否获得了多数派(包含自身)投票成员的心跳回复，否则退回follower
+func (n *Node) checkQuorum() {
+    now    := gtime.Millisecond()
+    quorum := n.getQuorumCount()
+    // 刚成为leader时还没有足够的心跳回复
+    if quorum <= 1 || now - atomic.LoadInt64(&n.LeaderSince) < gELECTION_TIMEOUT {
+        return
+    }
+    count := 1 // 包含自身
+    for _, info := range n.getVoterPeers() {
+        if t := n.HeartbeatAcks.Get(info.Id); t != nil && now - t.(int64) < gELECTION_TIMEOUT {
+            count++
+        }
+    }
+    if count < quorum {
+        glog.Printfln("check quorum failed, only %d of %d voters reachable, step down", count, quorum)
+        n.clearLeader()
+        n.setRaftRole(gROLE_RAFT_FOLLOWER)
+        n.updateElectionDeadline()
+    }
+}
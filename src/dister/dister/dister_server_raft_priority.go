@@ -0,0 +1,88 @@
+// leader优先级
+// 节点通过LeaderPriority设置成为leader的优先级(默认为0，数值越大越优先)，通过Zone设置可选的区域标签(例如机房名称)，用于让leader优先落在主机房：
+// 1. score选举模式下，日志同样新的节点之间优先级高者胜出，优先级相同时再比较选举比分；
+// 2. raft选举模式下，存在优先级更高的存活投票成员时，节点在选举超时之后额外等待一个选举超时时间，让优先级高的节点先发起选举；
+// 3. leader定期检查，发现日志已追上的优先级更高的存活投票成员时，通过leader转移将leader交给其中优先级最高的节点。
+// 优先级不影响数据安全：日志较旧的节点仍然无法赢得选举，优先级高的节点日志落后时需要等待其追上之后才会转移
+package dister
+
+import (
+    "time"
+    "sync/atomic"
+    "gitee.com/johng/gf/g/os/glog"
+    "gitee.com/johng/gf/g/os/gtime"
+)
+
+func (n *Node) getLeaderPriority() int32 {
+    return atomic.LoadInt32(&n.LeaderPriority)
+}
+
+func (n *Node) setLeaderPriority(priority int32) {
+    atomic.StoreInt32(&n.LeaderPriority, priority)
+}
+
+// 查找优先级比自身更高的存活server投票成员，存在多个时返回优先级最高(其次日志最新)的节点
+func (n *Node) findHigherPriorityVoter() *NodeInfo {
+    var target *NodeInfo
+    priority := n.getLeaderPriority()
+    for _, v := range n.getVoterPeers() {
+        info := v
+        if info.Role != gROLE_SERVER || info.Status != gSTATUS_ALIVE || info.LeaderPriority <= priority {
+            continue
+        }
+        if target == nil || info.LeaderPriority > target.LeaderPriority ||
+            (info.LeaderPriority == target.LeaderPriority && info.LastLogId > target.LastLogId) {
+            target = &info
+        }
+    }
+    return target
+}
+
+// raft选举模式下，存在优先级更高的存活投票成员时，额外等待的选举时间(毫秒)
+func (n *Node) getElectionPriorityDelay() int64 {
+    if n.isRaftElection() && n.findHigherPriorityVoter() != nil {
+        return gELECTION_TIMEOUT
+    }
+    return 0
+}
+
+// leader定期检查是否存在优先级更高且日志已追上的投票成员，存在则将leader转移给该节点；
+// 转移失败时按照检查间隔成倍退避(最长gLEADER_PRIORITY_BACKOFF_MAX)，避免目标节点异常时反复转移影响集群写入
+func (n *Node) leaderPriorityHandler() {
+    backoff := int64(0) // 当前的退避时间
+    until   := int64(0) // 退避结束的时间
+    for {
+        time.Sleep(gLEADER_PRIORITY_CHECK_INTERVAL * time.Millisecond)
+        if n.getRole() != gROLE_SERVER || n.getRaftRole() != gROLE_RAFT_LEADER {
+            continue
+        }
+        // 刚成为leader时各节点信息尚未通过心跳更新，等待一个检查周期，同时避免频繁转移
+        if gtime.Millisecond() - atomic.LoadInt64(&n.LeaderSince) < gLEADER_PRIORITY_CHECK_INTERVAL {
+            continue
+        }
+        if gtime.Millisecond() < until {
+            continue
+        }
+        info := n.findHigherPriorityVoter()
+        if info == nil {
+            backoff = 0
+            continue
+        }
+        // logid的高位为日志序号，落后过多的节点先由数据同步线程追赶，下次检查时再转移
+        if n.getLastLogId()/gLOGENTRY_RANDOM_ID_SIZE - info.LastLogId/gLOGENTRY_RANDOM_ID_SIZE > gLEADER_PRIORITY_MAX_LAG {
+            continue
+        }
+        glog.Printfln("%s has higher leader priority(%d) than current leader(%d), transferring leadership", info.Name, info.LeaderPriority, n.getLeaderPriority())
+        if _, err := n.transferLeader(info.Id); err != nil {
+            if backoff = backoff*2; backoff == 0 {
+                backoff = gLEADER_PRIORITY_CHECK_INTERVAL
+            } else if backoff > gLEADER_PRIORITY_BACKOFF_MAX {
+                backoff = gLEADER_PRIORITY_BACKOFF_MAX
+            }
+            until = gtime.Millisecond() + backoff
+            glog.Errorfln("leader priority transferring failed: %s, retry after %d ms", err.Error(), backoff)
+        } else {
+            backoff = 0
+        }
+    }
+}
@@ -0,0 +1,250 @@
+// 标准RAFT选举(raft选举模式)
+// 节点持久化存储当前任期(CurrentTerm)以及当前任期内的投票(VotedFor)，并使用随机化的选举超时时间；
+// 选举超时的节点将任期加1并投票给自己，向其他投票成员发送RequestVote请求，获得多数派(包含自身)投票后成为leader；
+// 节点在同一任期内只投出一票，并且只投给日志不比自身旧的候选者：先比较最后一条LogEntry的任期，任期相同时再比较LastLogId，
+// 避免日志更长但来自旧任期的候选者当选后覆盖已被多数派确认的日志；
+// 收到更高任期的消息时节点更新任期并退回follower，任期低于自身的leader心跳会被拒绝。
+// 集群中所有server节点需要使用相同的选举模式，score模式的集群将所有server节点的Election配置修改为raft后重启即可完成迁移。
+//
+// 任期隔离(两种选举模式通用)
+// 任期作为leader纪元随每个节点间消息的消息头发送，score选举模式下节点当选leader时同样进入新的任期；
+// raft及repl接口拒绝任期低于自身的消息并返回本节点的任期，发送方(例如已被取代但仍认为自己是leader的旧leader)收到更高任期后退回follower
+package dister
+
+import (
+    "fmt"
+    "net"
+    "sync/atomic"
+    "gitee.com/johng/gf/g/os/glog"
+    "gitee.com/johng/gf/g/os/gfile"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// 是否使用raft选举模式
+func (n *Node) isRaftElection() bool {
+    return n.Election == gELECTION_MODE_RAFT
+}
+
+func (n *Node) getCurrentTerm() int64 {
+    return atomic.LoadInt64(&n.CurrentTerm)
+}
+
+func (n *Node) getVotedFor() string {
+    n.mutex.RLock()
+    id := n.VotedFor
+    n.mutex.RUnlock()
+    return id
+}
+
+// 清除leader信息(例如进入新的任期时)
+func (n *Node) clearLeader() {
+    n.mutex.Lock()
+    n.Leader = nil
+    n.mutex.Unlock()
+}
+
+// 发起一轮raft选举，任期加1并投票给自己，获得多数派投票后成为leader
+func (n *Node) beginRaftElection() {
+    n.tmutex.Lock()
+    term := n.getCurrentTerm() + 1
+    if err := n.saveTermAndVote(term, n.getId()); err != nil {
+        n.tmutex.Unlock()
+        glog.Error("saving raft term error:", err)
+        n.updateElectionDeadline()
+        return
+    }
+    n.clearLeader()
+    n.setRaftRole(gROLE_RAFT_CANDIDATE)
+    n.tmutex.Unlock()
+    n.updateElectionDeadline()
+    glog.Debug("new raft election, term:", term)
+
+    // 拒绝投票时如果对方任期更高，接收消息时已经退回follower
+    count := n.requestVotes(gMSG_RAFT_VOTE_REQUEST, gMSG_RAFT_VOTE_GRANTED)
+
+    n.tmutex.Lock()
+    defer n.tmutex.Unlock()
+    // 选举期间进入了更高的任期，或者已经收到当前任期leader的心跳，那么本轮选举失败
+    if n.getCurrentTerm() != term || n.getRaftRole() != gROLE_RAFT_CANDIDATE {
+        return
+    }
+    if count >= n.getQuorumCount() {
+        glog.Printfln("won the raft election, term: %d, votes: %d", term, count)
+        n.setLeader(n.getNodeInfo())
+        n.setRaftRole(gROLE_RAFT_LEADER)
+    }
+}
+
+// 向其他投票成员并发发送投票(或者预投票)请求，请求中携带自身最后一条LogEntry的任期，
+// 按照回复到达的顺序计票，获得多数派(包含自身)投票后立即返回，不等待其余节点(例如已宕机节点的连接超时)，返回获得的票数
+func (n *Node) requestVotes(head int, granted int) int {
+    peers   := n.getVoterPeers()
+    quorum  := n.getQuorumCount()
+    body, _ := gjson.Encode(map[string]interface{} {
+        "LastLogTerm" : n.getLastLogTerm(),
+    })
+    result  := make(chan bool, len(peers))
+    for _, v := range peers {
+        go func(info NodeInfo) {
+            msg, err := n.sendAndReceiveMsgToNode(&info, gPORT_RAFT, head, body)
+            if err != nil {
+                n.updatePeerStatus(info.Id, gSTATUS_DEAD)
+                result <- false
+                return
+            }
+            result <- msg.Head == granted
+        }(v)
+    }
+    votes := 1 // 包含自身
+    for i := 0; i < len(peers) && votes < quorum; i++ {
+        if <-result {
+            votes++
+        }
+    }
+    return votes
+}
+
+// 判断候选者的日志是否不比自身旧，先比较最后一条LogEntry的任期，任期相同时比较logid
+func (n *Node) isLogUpToDate(term int64, logid int64) bool {
+    if lastTerm := n.getLastLogTerm(); term != lastTerm {
+        return term > lastTerm
+    }
+    return logid >= n.getLastLogId()
+}
+
+// 获取投票(或者预投票)请求中候选者最后一条LogEntry的任期
+func getLastLogTermFromMsg(msg *Msg) int64 {
+    if j, err := gjson.DecodeToJson(msg.Body); err == nil && j != nil {
+        return j.GetInt64("LastLogTerm")
+    }
+    return 0
+}
+
+// score选举模式下当选leader，同时进入新的任期，使旧leader发出的消息能够被识别为过期
+func (n *Node) becomeScoreLeader() {
+    n.tmutex.Lock()
+    defer n.tmutex.Unlock()
+    if err := n.saveTermAndVote(n.getCurrentTerm() + 1, n.getId()); err != nil {
+        glog.Error("saving raft term error:", err)
+        return
+    }
+    n.setLeader(n.getNodeInfo())
+    n.setRaftRole(gROLE_RAFT_LEADER)
+}
+
+// 检查消息头中携带的任期，发现更高的任期时更新任期并退回follower
+func (n *Node) checkTermFromMsg(msg *Msg) {
+    if msg.Info.Term <= n.getCurrentTerm() {
+        return
+    }
+    n.tmutex.Lock()
+    n.stepDownToTerm(msg.Info.Term)
+    n.tmutex.Unlock()
+}
+
+// 拒绝任期过期的消息，并向发送方返回head消息(消息头中携带本节点的任期)，返回true表示消息已被拒绝
+// 节点发现消息(HI)只用于建立联系，不做任期检查
+func (n *Node) rejectStaleTermMsg(conn net.Conn, msg *Msg, head int) bool {
+    term := n.getCurrentTerm()
+    if msg.Info.Term >= term || msg.Head == gMSG_RAFT_HI {
+        return false
+    }
+    glog.Debugfln("reject stale term message from %s, head: %d, term: %d, current term: %d", msg.Info.Name, msg.Head, msg.Info.Term, term)
+    n.sendMsg(conn, head, []byte(fmt.Sprintf("stale term %d, current term: %d", msg.Info.Term, term)))
+    return true
+}
+
+// 进入更高的任期并退回follower，新任期的leader未知，调用方需要持有tmutex锁
+func (n *Node) stepDownToTerm(term int64) {
+    if term <= n.getCurrentTerm() {
+        return
+    }
+    if err := n.saveTermAndVote(term, ""); err != nil {
+        glog.Error("saving raft term error:", err)
+    }
+    n.clearLeader()
+    n.setRaftRole(gROLE_RAFT_FOLLOWER)
+}
+
+// 更新任期及投票，server及witness节点在更新之前需要先持久化，调用方需要持有tmutex锁
+func (n *Node) saveTermAndVote(term int64, votedFor string) error {
+    if isVoterRole(n.getRole()) {
+        content, err := gjson.Encode(map[string]interface{} {
+            "CurrentTerm" : term,
+            "VotedFor"    : votedFor,
+        })
+        if err != nil {
+            return err
+        }
+        if err := writeFileAtomically(n.getRaftFilePath(), content); err != nil {
+            return err
+        }
+    }
+    n.mutex.Lock()
+    n.VotedFor = votedFor
+    n.mutex.Unlock()
+    atomic.StoreInt64(&n.CurrentTerm, term)
+    return nil
+}
+
+// 从磁盘恢复任期及投票
+func (n *Node) restoreRaftState() {
+    path := n.getRaftFilePath()
+    if !gfile.Exists(path) {
+        return
+    }
+    j, err := gjson.DecodeToJson(gfile.GetBinContents(path))
+    if err != nil {
+        glog.Fatal(err)
+    }
+    n.mutex.Lock()
+    n.VotedFor = j.GetString("VotedFor")
+    n.mutex.Unlock()
+    atomic.StoreInt64(&n.CurrentTerm, j.GetInt64("CurrentTerm"))
+}
+
+// RequestVote投票请求处理
+// 同一任期内只投出一票，并且候选者的日志不能比自身旧
+func (n *Node) onMsgRaftVoteRequest(conn net.Conn, msg *Msg) {
+    // 只有投票成员才能参与选举
+    if !n.isRaftElection() || !isVoterRole(n.getRole()) || msg.Info.Role != gROLE_SERVER || !n.isVoter(msg.Info.Id) {
+        n.sendMsg(conn, gMSG_RAFT_VOTE_REJECTED, nil)
+        return
+    }
+    term   := msg.Info.Term
+    result := gMSG_RAFT_VOTE_REJECTED
+    n.tmutex.Lock()
+    n.stepDownToTerm(term)
+    if term == n.getCurrentTerm() && n.isLogUpToDate(getLastLogTermFromMsg(msg), msg.Info.LastLogId) {
+        if votedFor := n.getVotedFor(); votedFor == "" || votedFor == msg.Info.Id {
+            if err := n.saveTermAndVote(term, msg.Info.Id); err != nil {
+                glog.Error("saving raft vote error:", err)
+            } else {
+                result = gMSG_RAFT_VOTE_GRANTED
+            }
+        }
+    }
+    n.tmutex.Unlock()
+    if result == gMSG_RAFT_VOTE_GRANTED {
+        // 投票之后重新计算选举超时，给予候选者完成选举的时间
+        n.updateElectionDeadline()
+    }
+    n.sendMsg(conn, result, nil)
+}
+
+// raft选举模式下的leader心跳处理，只承认任期不低于自身任期的leader
+func (n *Node) onMsgRaftTermHeartbeat(conn net.Conn, msg *Msg) {
+    n.tmutex.Lock()
+    if msg.Info.Term < n.getCurrentTerm() {
+        n.tmutex.Unlock()
+        n.sendMsg(conn, gMSG_RAFT_TERM_EXPIRED, nil)
+        return
+    }
+    n.stepDownToTerm(msg.Info.Term)
+    // 同一任期内只会产生一个leader，候选者收到当前任期leader的心跳时退回follower
+    n.setLeader(&msg.Info)
+    n.setRaftRole(gROLE_RAFT_FOLLOWER)
+    n.tmutex.Unlock()
+    n.updateElectionDeadline()
+    n.sendMsg(conn, gMSG_RAFT_HEARTBEAT, nil)
+}
@@ -0,0 +1,63 @@
+package dister
+
+import (
+    "testing"
+)
+
+// 投票时的日志新旧判断：先比较最后一条日志的任期，任期相同时比较logid
+func TestIsLogUpToDate(t *testing.T) {
+    n := NewServer()
+    n.setLastLogId(2000)
+    n.setLastLogTerm(3)
+    cases := []struct {
+        term   int64
+        logid  int64
+        expect bool
+    } {
+        {3, 2000, true},
+        {3, 2001, true},
+        {3, 1999, false},
+        // 任期更高时即使logid更小也更新
+        {4, 1000, true},
+        // 日志更长但来自旧任期的候选者不能当选
+        {2, 9000, false},
+        {0, 9000, false},
+    }
+    for k, v := range cases {
+        if r := n.isLogUpToDate(v.term, v.logid); r != v.expect {
+            t.Errorf("case %d: term %d, logid %d, expect %v, got %v", k, v.term, v.logid, v.expect, r)
+        }
+    }
+    // 旧版本的日志没有任期，此时只比较logid
+    n.setLastLogTerm(0)
+    if !n.isLogUpToDate(0, 2000) || n.isLogUpToDate(0, 1999) {
+        t.Error("legacy logs without term should be compared by logid")
+    }
+}
+
+// raft选举模式始终启用预投票及check-quorum，score选举模式在投票成员不少于3个时启用
+func TestIsQuorumCheckEnabled(t *testing.T) {
+    cases := []struct {
+        election string
+        peers    int
+        expect   bool
+    } {
+        {gELECTION_MODE_RAFT,  0, true},
+        {gELECTION_MODE_RAFT,  1, true},
+        {gELECTION_MODE_SCORE, 0, false},
+        {gELECTION_MODE_SCORE, 1, false},
+        {gELECTION_MODE_SCORE, 2, true},
+        {gELECTION_MODE_SCORE, 4, true},
+    }
+    for k, v := range cases {
+        n := NewServer()
+        n.Election = v.election
+        for i := 0; i < v.peers; i++ {
+            id := string(rune('A' + i))
+            n.Peers.Set(id, NodeInfo{Id: id, Name: id, Ip: id, Role: gROLE_SERVER, Status: gSTATUS_ALIVE})
+        }
+        if r := n.isQuorumCheckEnabled(); r != v.expect {
+            t.Errorf("case %d: expect %v, got %v", k, v.expect, r)
+        }
+    }
+}
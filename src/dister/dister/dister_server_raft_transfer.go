@@ -0,0 +1,137 @@
+// leader转移
+// 用于滚动维护时主动将leader转移到指定的server节点，而不需要停止leader并等待选举超时：
+// 1. leader等待目标节点的日志追上自身的LastLogId(由数据同步线程完成同步)；
+// 2. leader持有dmutex锁停止接受写入，等待目标节点同步剩余的日志；
+// 3. leader向目标节点发送TIMEOUT_NOW消息，目标节点立即发起选举(score选举模式下直接进入新的任期成为leader)，
+//    leader随后退回follower，新leader的任期更高，因此旧leader在此期间发出的消息均会被拒绝
+package dister
+
+import (
+    "net"
+    "time"
+    "errors"
+    "gitee.com/johng/gf/g/os/glog"
+    "gitee.com/johng/gf/g/os/gtime"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// 根据节点ID、名称或者IP查找投票成员，为空时选择leader优先级最高(其次日志最新)的存活投票成员
+func (n *Node) findLeaderTransferTarget(node string) (*NodeInfo, error) {
+    var target *NodeInfo
+    for _, v := range n.getVoterPeers() {
+        info := v
+        // witness节点不能成为leader
+        if info.Role == gROLE_WITNESS {
+            continue
+        }
+        if node == "" {
+            if info.Status != gSTATUS_ALIVE {
+                continue
+            }
+            if target == nil || info.LeaderPriority > target.LeaderPriority ||
+                (info.LeaderPriority == target.LeaderPriority && info.LastLogId > target.LastLogId) {
+                target = &info
+            }
+        } else if info.Id == node || info.Name == node || info.Ip == node {
+            target = &info
+            break
+        }
+    }
+    if target == nil {
+        if node == "" {
+            return nil, errors.New("no alive voter to transfer leadership to")
+        }
+        if node == n.getId() || node == n.getName() || node == n.getIp() {
+            return nil, errors.New("node " + node + " is already the leader")
+        }
+        return nil, errors.New("voter not found: " + node)
+    }
+    if target.Status != gSTATUS_ALIVE {
+        return nil, errors.New("node " + target.Name + " is not alive")
+    }
+    return target, nil
+}
+
+// 等待目标节点的日志追上leader，超时返回false(用于leader转移及添加投票成员)
+func (n *Node) waitNodeCatchUp(info *NodeInfo, deadline int64) bool {
+    for gtime.Millisecond() < deadline {
+        // 通过HI消息获取目标节点最新的LastLogId
+        if msg, err := n.sendAndReceiveMsgToNode(info, gPORT_RAFT, gMSG_RAFT_HI, nil); err == nil {
+            if msg.Info.LastLogId >= n.getLastLogId() {
+                return true
+            }
+        }
+        time.Sleep(100 * time.Millisecond)
+    }
+    return false
+}
+
+// 将leader转移到目标节点，成功后返回目标节点信息
+func (n *Node) transferLeader(node string) (*NodeInfo, error) {
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        return nil, errors.New("current node is not the leader")
+    }
+    info, err := n.findLeaderTransferTarget(node)
+    if err != nil {
+        return nil, err
+    }
+    glog.Printfln("transferring leadership to %s, logid: %d, target logid: %d", info.Name, n.getLastLogId(), info.LastLogId)
+    deadline := gtime.Millisecond() + gLEADER_TRANSFER_TIMEOUT
+    if !n.waitNodeCatchUp(info, deadline) {
+        return nil, errors.New("timeout waiting for " + info.Name + " to catch up with the leader")
+    }
+    // 停止接受写入，排队中的写入在转移完成之后因为角色变化而失败，需要客户端向新leader重试
+    n.dmutex.Lock()
+    defer n.dmutex.Unlock()
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        return nil, errors.New("leadership lost during transferring")
+    }
+    if !n.waitNodeCatchUp(info, deadline) {
+        return nil, errors.New("timeout waiting for " + info.Name + " to catch up with the leader")
+    }
+    msg, err := n.sendAndReceiveMsgToNode(info, gPORT_RAFT, gMSG_RAFT_TIMEOUT_NOW, nil)
+    if err != nil {
+        return nil, err
+    }
+    if msg.Head != gMSG_RAFT_RESPONSE {
+        return nil, errors.New(info.Name + " refused to start the election: " + string(msg.Body))
+    }
+    // 退回follower等待新leader的心跳
+    n.clearLeader()
+    n.setRaftRole(gROLE_RAFT_FOLLOWER)
+    n.updateElectionDeadline()
+    glog.Printfln("leadership transferred to %s", info.Name)
+    return info, nil
+}
+
+// 目标节点收到leader的TIMEOUT_NOW消息后立即发起选举
+func (n *Node) onMsgRaftTimeoutNow(conn net.Conn, msg *Msg) {
+    leader := n.getLeader()
+    if n.getRole() != gROLE_SERVER || msg.Info.RaftRole != gROLE_RAFT_LEADER || leader == nil || leader.Id != msg.Info.Id {
+        n.sendMsg(conn, gMSG_RAFT_FAILED, []byte("not a server node following the sender"))
+        return
+    }
+    if n.getLastLogId() < msg.Info.LastLogId {
+        n.sendMsg(conn, gMSG_RAFT_FAILED, []byte("log is not up to date"))
+        return
+    }
+    glog.Printfln("received timeout now from %s, start election", msg.Info.Name)
+    if n.isRaftElection() {
+        // 选举需要向leader请求投票，因此异步执行，不阻塞当前的回复
+        go n.beginRaftElection()
+    } else {
+        n.becomeScoreLeader()
+    }
+    n.sendMsg(conn, gMSG_RAFT_RESPONSE, nil)
+}
+
+// 用于API接口的leader转移，由leader执行
+func (n *Node) onMsgApiLeaderTransfer(conn net.Conn, msg *Msg) {
+    info, err := n.transferLeader(string(msg.Body))
+    if err != nil {
+        n.sendMsg(conn, gMSG_REPL_FAILED, []byte(err.Error()))
+        return
+    }
+    b, _ := gjson.Encode(info)
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
+}
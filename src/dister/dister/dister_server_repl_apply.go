@@ -0,0 +1,109 @@
+// 日志应用
+// 节点写入LogEntry时先记录到日志文件并加入待应用列表，只有已提交的LogEntry才会写入DataMap等内存数据，读取请求因此只会读到已提交的数据：
+// 1. leader的日志即为集群的最终结果，leader写入的LogEntry(包括成为leader之前尚未应用的日志)直接应用，
+//    使用leader/one级别写入的数据在leader上立即可见，这是这两个持久化级别本身的语义；
+// 2. follower只应用已提交的LogEntry，已提交logid来自leader的消息头，但只信任本地日志中已确认与leader一致的部分(MatchLogId)，
+//    未能获得多数派确认的写入会残留在少数派follower的日志末尾，这部分日志与leader不一致，永远不会被应用，由数据修复流程清理；
+// 3. 以下情况可以确认本地日志与leader一致：leader追加写入时前一条logid匹配、数据同步线程从leader日志中同步的LogEntry、
+//    本地日志中存在与leader已提交logid相同的LogEntry(logid全局唯一，追加写入时前一条logid必须匹配，因此其之前的日志同样一致)
+package dister
+
+import (
+    "sync/atomic"
+    "gitee.com/johng/gf/g/os/gcache"
+)
+
+func (n *Node) getAppliedLogId() int64 {
+    return atomic.LoadInt64(&n.AppliedLogId)
+}
+
+func (n *Node) getAppliedLogTerm() int64 {
+    return atomic.LoadInt64(&n.AppliedLogTerm)
+}
+
+func (n *Node) setAppliedLogId(id int64, term int64) {
+    atomic.StoreInt64(&n.AppliedLogId, id)
+    atomic.StoreInt64(&n.AppliedLogTerm, term)
+}
+
+func (n *Node) getMatchLogId() int64 {
+    return atomic.LoadInt64(&n.MatchLogId)
+}
+
+// 更新本地日志中已确认与leader一致的logid，只增不减(数据重置时由resetAppliedLogId重新设置)
+func (n *Node) updateMatchLogId(id int64) {
+    if id > n.getMatchLogId() {
+        atomic.StoreInt64(&n.MatchLogId, id)
+    }
+}
+
+func (n *Node) getLeaderCommitLogId() int64 {
+    return atomic.LoadInt64(&n.LeaderCommitLogId)
+}
+
+// 重置应用状态(清空本地数据、加载快照或者重建数据时)，调用方需要持有dmutex锁
+func (n *Node) resetAppliedLogId(id int64, term int64) {
+    n.PendingLogEntries = nil
+    n.setAppliedLogId(id, term)
+    atomic.StoreInt64(&n.MatchLogId, id)
+    atomic.StoreInt64(&n.LeaderCommitLogId, 0)
+    n.setCommitLogId(id)
+}
+
+// 应用已提交的LogEntry，调用方需要持有dmutex锁
+func (n *Node) applyCommittedLogEntries() {
+    if len(n.PendingLogEntries) == 0 {
+        return
+    }
+    leader := n.getRaftRole() == gROLE_RAFT_LEADER
+    if !leader {
+        // 本地日志中存在leader已提交的LogEntry时，其之前的日志均与leader一致
+        commitId := n.getLeaderCommitLogId()
+        for _, v := range n.PendingLogEntries {
+            if v.Id == commitId {
+                n.updateMatchLogId(commitId)
+                break
+            }
+        }
+        id := n.getMatchLogId()
+        if commitId < id {
+            id = commitId
+        }
+        if id > n.getCommitLogId() {
+            n.setCommitLogId(id)
+        }
+    }
+    commitId := n.getCommitLogId()
+    i        := 0
+    for ; i < len(n.PendingLogEntries); i++ {
+        entry := n.PendingLogEntries[i]
+        if !leader && entry.Id > commitId {
+            break
+        }
+        n.saveLogEntryToVar(&entry)
+        n.setAppliedLogId(entry.Id, entry.Term)
+    }
+    n.PendingLogEntries = n.PendingLogEntries[i:]
+}
+
+// 异步应用已提交的LogEntry，用于未持有dmutex锁的调用方(例如接收消息时获取到新的已提交logid)
+func (n *Node) applyCommittedLogEntriesAsync() {
+    if n.getRaftRole() == gROLE_RAFT_LEADER {
+        if n.getLastLogId() <= n.getAppliedLogId() {
+            return
+        }
+    } else if n.getLeaderCommitLogId() <= n.getAppliedLogId() {
+        return
+    }
+    key := "dister_applying_log_entries"
+    if gcache.Get(key) != nil {
+        return
+    }
+    gcache.Set(key, struct {}{}, 60000)
+    go func() {
+        defer gcache.Remove(key)
+        n.dmutex.Lock()
+        n.applyCommittedLogEntries()
+        n.dmutex.Unlock()
+    }()
+}
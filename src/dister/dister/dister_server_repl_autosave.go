@@ -19,12 +19,12 @@ func (n *Node) autoSavingHandler() {
     if n.getRole() != gROLE_SERVER {
         return
     }
-    lastLogId     := n.getLastLogId()
+    lastLogId     := n.getAppliedLogId()
     lastServiceId := n.getLastServiceLogId()
     for {
-        if n.getLastLogId() != lastLogId {
+        if n.getAppliedLogId() != lastLogId {
             n.saveDataToFile()
-            lastLogId = n.getLastLogId()
+            lastLogId = n.getAppliedLogId()
         }
         if n.getLastServiceLogId() != lastServiceId {
             n.saveServiceToFile()
@@ -43,11 +43,7 @@ func (n *Node) saveDataToFile() {
     gcache.Set(key, struct {}{}, 6000000)
     defer gcache.Remove(key)
 
-    data := make(map[string]interface{})
-    data  = map[string]interface{} {
-        "LastLogId"   : n.getLastLogId(),
-        "DataMap"     : *n.DataMap.Clone(),
-    }
+    data := n.getDataSnapshot()
     content, err := gjson.Encode(data)
     if err != nil {
         return
@@ -55,8 +51,26 @@ func (n *Node) saveDataToFile() {
     if gCOMPRESS_SAVING {
         content = gcompress.Zlib(content)
     }
-    if err := gfile.PutBinContents(n.getDataFilePath(), content); err != nil {
+    // 快照是日志压缩的依据，因此需要保证写入的原子性，写入成功后才更新快照logid
+    if err := writeFileAtomically(n.getDataFilePath(), content); err != nil {
         glog.Error("saving data error:", err)
+        return
+    }
+    n.setSnapshotLogId(data["LastLogId"].(int64))
+}
+
+// 获取当前数据的快照，持有dmutex读锁以保证数据与logid的一致性，快照只包含已应用的日志
+func (n *Node) getDataSnapshot() map[string]interface{} {
+    n.dmutex.RLock()
+    defer n.dmutex.RUnlock()
+    return map[string]interface{} {
+        "LastLogId"   : n.getAppliedLogId(),
+        "LastLogTerm" : n.getAppliedLogTerm(),
+        "DataMap"     : *n.DataMap.Clone(),
+        "DataMeta"    : *n.DataMeta.Clone(),
+        "Sessions"    : *n.Sessions.Clone(),
+        "Locks"       : *n.Locks.Clone(),
+        "Voters"      : *n.Voters.Clone(),
     }
 }
 
@@ -88,10 +102,18 @@ func (n *Node) saveServiceToFile() {
 
 // 从物理化文件中恢复变量
 func (n *Node) restoreFromFile() {
+    // witness节点只存储任期、投票、logid及投票成员表
+    if n.getRole() == gROLE_WITNESS {
+        n.restoreRaftState()
+        n.restoreWitnessState()
+        return
+    }
     // 只有server节点才进行数据物理化存储
     if n.getRole() != gROLE_SERVER {
         return
     }
+    // 恢复RAFT任期及投票
+    n.restoreRaftState()
 
     var wg sync.WaitGroup
 
@@ -111,7 +133,14 @@ func (n *Node) restoreFromFile() {
 
 // 恢复DataMap
 func (n *Node) restoreDataMap() {
+    n.restoreCompactLogId()
     path := n.getDataFilePath()
+    // 日志已被压缩但快照文件不存在时无法恢复数据，清空本地数据后由leader安装快照
+    if !gfile.Exists(path) && n.getCompactLogId() > 0 {
+        glog.Printfln("data snapshot not found for compacted log, waiting for snapshot installation from leader")
+        n.resetLocalData()
+        return
+    }
     if gfile.Exists(path) {
         bin := gfile.GetBinContents(path)
         if gCOMPRESS_SAVING {
@@ -123,22 +152,15 @@ func (n *Node) restoreDataMap() {
             if err != nil {
                 glog.Fatal(err)
             }
-            m  := make(map[string]string)
-            id := j.GetInt64("LastLogId")
-            if err := j.GetToVar("DataMap", &m); err == nil {
-                n.DataMap.BatchSet(m)
-            } else {
-                glog.Error(err)
-            }
+            id := n.loadDataSnapshot(j)
+            n.setSnapshotLogId(id)
             // 判断日志与数据存储的一致性，并执行校验恢复
+            // 快照之后的日志不一定已经提交，加入待应用列表，由leader确认提交之后再应用
             list := n.getLogEntryListFromFileByLogId(id, 0, false)
             if len(list) > 0 {
-                logid := id
-                for _, v := range list {
-                    logid = v.Id
-                    n.saveLogEntryToVar(&v)
-                }
-                n.setLastLogId(logid)
+                n.PendingLogEntries = list
+                n.setLastLogId(list[len(list) - 1].Id)
+                n.setLastLogTerm(list[len(list) - 1].Term)
             } else {
                 n.setLastLogId(id)
             }
@@ -146,6 +168,63 @@ func (n *Node) restoreDataMap() {
     }
 }
 
+// 从快照中加载数据，返回快照对应的logid
+func (n *Node) loadDataSnapshot(j *gjson.Json) int64 {
+    m  := make(map[string]string)
+    id := j.GetInt64("LastLogId")
+    // 旧版本的数据文件没有记录任期，此时任期为0
+    n.setLastLogTerm(j.GetInt64("LastLogTerm"))
+    n.resetAppliedLogId(id, j.GetInt64("LastLogTerm"))
+    if err := j.GetToVar("DataMap", &m); err == nil {
+        n.DataMap.BatchSet(m)
+        n.resetDataSize()
+    } else {
+        glog.Error(err)
+    }
+    // 旧版本的数据文件没有元数据
+    if j.Get("DataMeta") != nil {
+        meta := make(map[string]KvMeta)
+        if err := j.GetToVar("DataMeta", &meta); err == nil {
+            for k, v := range meta {
+                n.setKvMeta(k, v)
+            }
+        } else {
+            glog.Error(err)
+        }
+    }
+    if j.Get("Sessions") != nil {
+        sessions := make(map[string]Session)
+        if err := j.GetToVar("Sessions", &sessions); err == nil {
+            for k, v := range sessions {
+                n.Sessions.Set(k, v)
+            }
+        } else {
+            glog.Error(err)
+        }
+    }
+    if j.Get("Locks") != nil {
+        locks := make(map[string]Lock)
+        if err := j.GetToVar("Locks", &locks); err == nil {
+            for k, v := range locks {
+                n.Locks.Set(k, v)
+            }
+        } else {
+            glog.Error(err)
+        }
+    }
+    if j.Get("Voters") != nil {
+        voters := make(map[string]Member)
+        if err := j.GetToVar("Voters", &voters); err == nil {
+            for k, v := range voters {
+                n.Voters.Set(k, v)
+            }
+        } else {
+            glog.Error(err)
+        }
+    }
+    return id
+}
+
 // 恢复Service
 func (n *Node) restoreService() {
     path := n.getServiceFilePath()
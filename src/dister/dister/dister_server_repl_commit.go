@@ -0,0 +1,124 @@
+// 写入提交
+// leader提交写入时将LogEntry发送给所有存活的server节点，根据写入请求的持久化级别等待足够数量的server节点写入成功后才在本地写入并返回成功，
+// 默认的quorum级别需要多数派(包含leader)的server节点写入成功，保证已返回成功的写入在网络分区时不会丢失；
+// 已提交logid(CommitLogId)由leader根据各server节点的LastLogId计算(多数派已写入的最大logid)，并随消息头同步给其他节点，
+// 使用leader/one级别写入的数据在同步到多数派之前不计入已提交logid；follower只应用已提交的日志(见日志应用)
+package dister
+
+import (
+    "sort"
+    "errors"
+    "sync/atomic"
+)
+
+// 判断写入持久化级别是否有效，为空表示默认的quorum
+func isValidDurability(durability string) bool {
+    switch durability {
+        case "", gDURABILITY_LEADER, gDURABILITY_ONE, gDURABILITY_QUORUM, gDURABILITY_ALL:
+            return true
+    }
+    return false
+}
+
+// 检查写入来源中的持久化级别
+func checkLogOriginDurability(origin *LogOrigin) error {
+    if origin != nil && !isValidDurability(origin.Durability) {
+        return errors.New("invalid durability: " + origin.Durability + ", should be one of: leader, one, quorum, all")
+    }
+    return nil
+}
+
+// 获取写入来源对应的持久化级别
+func getLogEntryDurability(entry *LogEntry) string {
+    if entry.Origin != nil && entry.Origin.Durability != "" && isValidDurability(entry.Origin.Durability) {
+        return entry.Origin.Durability
+    }
+    return gDURABILITY_QUORUM
+}
+
+// 获取持久化级别需要写入成功的其他投票成员数量(不包含leader)，返回需要的总确认数及其中需要的server节点(存储数据)确认数，
+// servers及witnesses为集群中其他server及witness投票成员的数量(包含未存活的节点)；
+// witness节点不存储数据，只计入多数派确认，one及all级别表示数据副本的数量，只能由server节点确认；
+// quorum级别在存在其他server节点时至少需要一个server节点确认，保证已提交的写入在leader故障时仍然存在数据副本
+func (n *Node) getDurabilityAckCount(durability string, servers int, witnesses int) (int, int) {
+    quorum := n.getQuorumCount() - 1
+    if quorum > servers + witnesses {
+        quorum = servers + witnesses
+    }
+    switch durability {
+        case gDURABILITY_LEADER:
+            return 0, 0
+
+        case gDURABILITY_ONE:
+            if servers == 0 {
+                return 0, 0
+            }
+            return 1, 1
+
+        case gDURABILITY_ALL:
+            // 所有server节点都写入成功，同时仍然需要满足多数派
+            if servers < quorum {
+                return quorum, servers
+            }
+            return servers, servers
+    }
+    if quorum == 0 || servers == 0 {
+        return quorum, 0
+    }
+    return quorum, 1
+}
+
+// 获取集群中其他投票成员中server及witness节点的数量(包含未存活的节点)
+func (n *Node) getVoterPeersCount() (int, int) {
+    servers, witnesses := 0, 0
+    for _, info := range n.getVoterPeers() {
+        if info.Role == gROLE_WITNESS {
+            witnesses++
+        } else {
+            servers++
+        }
+    }
+    return servers, witnesses
+}
+
+// leader根据各投票成员的LastLogId计算已提交logid，即多数派(包含leader)已写入的最大logid，
+// 与quorum级别的写入一致，存在其他server节点时还需要至少一个server节点已写入
+func (n *Node) updateCommitLogId() {
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        return
+    }
+    ids     := []int64{n.getLastLogId()}
+    servers := 0
+    maxData := int64(0)
+    for _, info := range n.getVoterPeers() {
+        ids = append(ids, info.LastLogId)
+        if info.Role != gROLE_WITNESS {
+            servers++
+            if info.LastLogId > maxData {
+                maxData = info.LastLogId
+            }
+        }
+    }
+    sort.Slice(ids, func(i, j int) bool {
+        return ids[i] > ids[j]
+    })
+    id := ids[n.getQuorumCount() - 1]
+    if servers > 0 && maxData < id {
+        id = maxData
+    }
+    if id > n.getCommitLogId() {
+        n.setCommitLogId(id)
+    }
+}
+
+// 从当前leader的消息中获取已提交logid，并异步应用本地日志中已提交的部分
+func (n *Node) followCommitLogId(msg *Msg) {
+    leader := n.getLeader()
+    if leader == nil || leader.Id != msg.Info.Id || msg.Info.RaftRole != gROLE_RAFT_LEADER {
+        return
+    }
+    if id := msg.Info.CommitLogId; id > n.getLeaderCommitLogId() {
+        atomic.StoreInt64(&n.LeaderCommitLogId, id)
+    }
+    n.applyCommittedLogEntriesAsync()
+}
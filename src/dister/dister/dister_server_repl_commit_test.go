@@ -0,0 +1,151 @@
+package dister
+
+import (
+    "testing"
+)
+
+// 创建一个包含指定LastLogId的server节点的测试集群(投票成员表为空，所有server节点均为投票成员)
+func newTestCluster(lastLogId int64, peers ...int64) *Node {
+    n := NewServer()
+    n.setLastLogId(lastLogId)
+    for k, v := range peers {
+        id := string(rune('A' + k))
+        n.Peers.Set(id, NodeInfo{Id: id, Name: id, Ip: id, Role: gROLE_SERVER, Status: gSTATUS_ALIVE, LastLogId: v})
+    }
+    return n
+}
+
+// 已提交logid为多数派(包含leader)已写入的最大logid
+func TestUpdateCommitLogId(t *testing.T) {
+    cases := []struct {
+        last   int64
+        peers  []int64
+        expect int64
+    } {
+        {300, []int64{}, 300},
+        {300, []int64{200}, 200},
+        {300, []int64{200, 100}, 200},
+        {300, []int64{300, 100}, 300},
+        {300, []int64{100, 100, 300, 200}, 200},
+        {300, []int64{0, 0}, 0},
+    }
+    for k, v := range cases {
+        n := newTestCluster(v.last, v.peers...)
+        n.setRaftRole(gROLE_RAFT_LEADER)
+        n.updateCommitLogId()
+        if r := n.getCommitLogId(); r != v.expect {
+            t.Errorf("case %d: expect %d, got %d", k, v.expect, r)
+        }
+    }
+    // witness节点的确认不能单独构成多数派
+    n := newTestCluster(300, 100)
+    n.Peers.Set("W", NodeInfo{Id: "W", Name: "W", Ip: "W", Role: gROLE_WITNESS, Status: gSTATUS_ALIVE, LastLogId: 300})
+    n.setRaftRole(gROLE_RAFT_LEADER)
+    n.updateCommitLogId()
+    if r := n.getCommitLogId(); r != 100 {
+        t.Errorf("witness only commit: expect 100, got %d", r)
+    }
+    // follower不计算已提交logid
+    n = newTestCluster(300, 300)
+    n.updateCommitLogId()
+    if r := n.getCommitLogId(); r != 0 {
+        t.Errorf("follower should not update commit logid, got %d", r)
+    }
+}
+
+// follower只应用已提交并且已确认与leader一致的日志
+func TestApplyCommittedLogEntries(t *testing.T) {
+    newNode := func() *Node {
+        n := NewServer()
+        for i := int64(1); i <= 3; i++ {
+            k := string(rune('a' + i - 1))
+            n.PendingLogEntries = append(n.PendingLogEntries, LogEntry {
+                Id    : i,
+                Act   : gMSG_REPL_DATA_SET,
+                Items : map[string]interface{}{k: k},
+            })
+            n.setLastLogId(i)
+        }
+        return n
+    }
+    cases := []struct {
+        match   int64
+        commit  int64
+        applied int64
+    } {
+        // 尚未获得已提交logid
+        {3, 0, 0},
+        // 已提交logid存在于本地日志中，其之前的日志均已提交
+        {0, 2, 2},
+        {0, 3, 3},
+        // 已提交logid不在本地日志中(本地日志末尾可能是未提交的写入)，只应用已确认一致的部分
+        {1, 5, 1},
+        {2, 5, 2},
+        {3, 2, 2},
+    }
+    for k, v := range cases {
+        n := newNode()
+        n.updateMatchLogId(v.match)
+        n.LeaderCommitLogId = v.commit
+        n.applyCommittedLogEntries()
+        if r := n.getAppliedLogId(); r != v.applied {
+            t.Errorf("case %d: expect applied %d, got %d", k, v.applied, r)
+        }
+        if len(n.PendingLogEntries) != int(3 - v.applied) || n.DataMap.Size() != int(v.applied) {
+            t.Errorf("case %d: pending %d, data size %d", k, len(n.PendingLogEntries), n.DataMap.Size())
+        }
+    }
+    // leader直接应用所有日志
+    n := newNode()
+    n.setRaftRole(gROLE_RAFT_LEADER)
+    n.applyCommittedLogEntries()
+    if r := n.getAppliedLogId(); r != 3 {
+        t.Errorf("leader should apply all entries, got %d", r)
+    }
+}
+
+// witness节点只计入多数派确认，one及all级别只能由server节点确认，存在其他server节点时多数派至少包含一个server节点
+func TestGetDurabilityAckCount(t *testing.T) {
+    cases := []struct {
+        servers    int
+        witnesses  int
+        durability string
+        count      int
+        data       int
+    } {
+        {2, 0, gDURABILITY_LEADER, 0, 0},
+        {2, 0, gDURABILITY_ONE,    1, 1},
+        {2, 0, gDURABILITY_QUORUM, 1, 1},
+        {2, 0, gDURABILITY_ALL,    2, 2},
+        {1, 1, gDURABILITY_ONE,    1, 1},
+        {1, 1, gDURABILITY_QUORUM, 1, 1},
+        {1, 1, gDURABILITY_ALL,    1, 1},
+        {0, 2, gDURABILITY_ONE,    0, 0},
+        {0, 2, gDURABILITY_QUORUM, 1, 0},
+        {0, 2, gDURABILITY_ALL,    1, 0},
+        {4, 0, gDURABILITY_QUORUM, 2, 1},
+        {2, 2, gDURABILITY_QUORUM, 2, 1},
+        {4, 0, gDURABILITY_ALL,    4, 4},
+        {1, 3, gDURABILITY_ALL,    2, 1},
+        {0, 0, gDURABILITY_ALL,    0, 0},
+    }
+    for k, v := range cases {
+        n := NewServer()
+        for i := 0; i < v.servers + v.witnesses; i++ {
+            id   := string(rune('A' + i))
+            role := int32(gROLE_SERVER)
+            if i >= v.servers {
+                role = gROLE_WITNESS
+            }
+            n.Peers.Set(id, NodeInfo{Id: id, Name: id, Ip: id, Role: role, Status: gSTATUS_ALIVE})
+        }
+        servers, witnesses := n.getVoterPeersCount()
+        if servers != v.servers || witnesses != v.witnesses {
+            t.Errorf("case %d: expect %d servers and %d witnesses, got %d and %d", k, v.servers, v.witnesses, servers, witnesses)
+        }
+        count, data := n.getDurabilityAckCount(v.durability, servers, witnesses)
+        if count != v.count || data != v.data {
+            t.Errorf("case %d: %s expect (%d, %d), got (%d, %d)", k, v.durability, v.count, v.data, count, data)
+        }
+    }
+}
@@ -0,0 +1,193 @@
+// 日志压缩
+// 当数据快照已经持久化(快照logid为X)，并且所有存活的server节点都已经同步到X之后，X之前的日志不再需要用于数据恢复及同步，
+// 此时在保留LogRetain数量的日志后，按照日志文件批次整体归档或者删除更早的日志文件，并持久化记录压缩点；
+// 同步时logid小于leader压缩点的节点(例如压缩期间离线的节点、新加入的节点)无法进行增量同步，由leader先安装数据快照再进行增量同步
+package dister
+
+import (
+    "os"
+    "net"
+    "time"
+    "path/filepath"
+    "gitee.com/johng/gf/g/os/glog"
+    "gitee.com/johng/gf/g/os/gfile"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// 日志自动压缩处理，每个server节点各自压缩本地的日志文件
+func (n *Node) autoCompactLog() {
+    // 只有server节点才进行数据物理化存储
+    if n.getRole() != gROLE_SERVER {
+        return
+    }
+    for {
+        if n.LogCompact {
+            n.compactLog()
+        }
+        time.Sleep(gLOG_COMPACT_INTERVAL * time.Millisecond)
+    }
+}
+
+// 执行日志压缩
+func (n *Node) compactLog() {
+    // 安全点为已持久化的快照logid与所有存活server节点已同步logid中的最小值
+    safeId := n.getSnapshotLogId()
+    if minId := n.getMinLogIdFromPeers(); minId < safeId {
+        safeId = minId
+    }
+    cutoff := safeId - n.LogRetain*gLOGENTRY_RANDOM_ID_SIZE
+    if cutoff <= 0 {
+        return
+    }
+    // 日志文件按照批次整体压缩，cutoff所在的批次及其之后的日志文件保留
+    no        := n.getLogEntryBatachNo(cutoff)
+    compactId := no*gLOGENTRY_FILE_SIZE*gLOGENTRY_RANDOM_ID_SIZE
+    if compactId <= n.getCompactLogId() {
+        return
+    }
+    // 先持久化压缩点再清理日志文件，保证读取日志时不会访问已清理的文件
+    if err := n.saveCompactLogId(compactId); err != nil {
+        glog.Error("saving compact logid error:", err)
+        return
+    }
+    n.setCompactLogId(compactId)
+    count := 0
+    for i := int64(0); i < no; i++ {
+        if !gfile.Exists(n.getLogEntryFileSavePathByBatchNo(i)) {
+            continue
+        }
+        if err := n.removeLogEntryFile(i); err != nil {
+            glog.Error("compacting log file error:", err)
+            return
+        }
+        count++
+    }
+    glog.Printfln("log compacted, compact logid: %d, snapshot logid: %d, files: %d", compactId, n.getSnapshotLogId(), count)
+}
+
+// 归档或者删除指定批次的日志文件
+func (n *Node) removeLogEntryFile(no int64) error {
+    path := n.getLogEntryFileSavePathByBatchNo(no)
+    if n.LogArchivePath == "" {
+        return os.Remove(path)
+    }
+    dest := n.getLogEntryArchivePathByBatchNo(no)
+    if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+        return err
+    }
+    return os.Rename(path, dest)
+}
+
+// 保存日志压缩点到磁盘
+func (n *Node) saveCompactLogId(id int64) error {
+    content, err := gjson.Encode(map[string]interface{} {
+        "CompactLogId" : id,
+    })
+    if err != nil {
+        return err
+    }
+    return writeFileAtomically(n.getCompactFilePath(), content)
+}
+
+// 从磁盘恢复日志压缩点
+func (n *Node) restoreCompactLogId() {
+    path := n.getCompactFilePath()
+    if !gfile.Exists(path) {
+        return
+    }
+    j, err := gjson.DecodeToJson(gfile.GetBinContents(path))
+    if err != nil {
+        glog.Fatal(err)
+    }
+    n.setCompactLogId(j.GetInt64("CompactLogId"))
+}
+
+// 清空本地数据、日志文件及数据快照，等待leader安装快照
+func (n *Node) resetLocalData() {
+    n.dmutex.Lock()
+    defer n.dmutex.Unlock()
+    n.clearLocalData()
+    n.setLastLogId(0)
+    n.setLastLogTerm(0)
+    n.setCompactLogId(0)
+    if err := n.saveCompactLogId(0); err != nil {
+        glog.Error("saving compact logid error:", err)
+    }
+}
+
+// 清空内存数据、日志文件及数据快照，调用方需要持有dmutex锁
+func (n *Node) clearLocalData() {
+    n.DataMap.Clear()
+    n.resetDataSize()
+    n.DataMeta.Clear()
+    n.DataExpire.Clear()
+    n.Sessions.Clear()
+    n.Locks.Clear()
+    n.Voters.Clear()
+    n.resetAppliedLogId(0, 0)
+    if err := os.RemoveAll(n.getSavePath() + gfile.Separator + "dister.entry.log"); err != nil {
+        glog.Error(err)
+    }
+    if gfile.Exists(n.getDataFilePath()) {
+        gfile.Remove(n.getDataFilePath())
+    }
+    n.setSnapshotLogId(0)
+}
+
+// 安装数据快照到目标节点
+// leader->follower
+func (n *Node) installSnapshotToRemoteNode(conn net.Conn, info *NodeInfo) {
+    var data map[string]interface{}
+    if info.Role == gROLE_WITNESS {
+        data = n.getWitnessSnapshot()
+    } else {
+        data = n.getDataSnapshot()
+    }
+    b, err := gjson.Encode(data)
+    if err != nil {
+        glog.Error(err)
+        return
+    }
+    glog.Printfln("install snapshot from %s to %s, snapshot logid: %d, node logid: %d", n.getName(), info.Name, data["LastLogId"], info.LastLogId)
+    if err := n.sendMsg(conn, gMSG_REPL_SNAPSHOT_INSTALL, b); err != nil {
+        glog.Error(err)
+        return
+    }
+    // 快照可能较大，目标节点写入需要更长的时间
+    if rmsg := n.receiveMsgWithTimeout(conn, 60*time.Second); rmsg == nil || rmsg.Head != gMSG_REPL_RESPONSE {
+        glog.Printfln("snapshot installation from %s to %s failed", n.getName(), info.Name)
+    }
+}
+
+// 安装leader发送的数据快照，丢弃本地所有的数据及日志
+// follower<-leader
+func (n *Node) onMsgReplSnapshotInstall(conn net.Conn, msg *Msg) {
+    j, err := gjson.DecodeToJson(msg.Body)
+    if err != nil || !isVoterRole(n.getRole()) || msg.Info.RaftRole != gROLE_RAFT_LEADER || n.getRaftRole() == gROLE_RAFT_LEADER {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+        return
+    }
+    if n.getRole() == gROLE_WITNESS {
+        n.dmutex.Lock()
+        id := n.loadWitnessSnapshot(j)
+        n.saveWitnessState()
+        n.dmutex.Unlock()
+        glog.Printfln("witness snapshot installed from %s, logid: %d", msg.Info.Name, id)
+        n.sendMsg(conn, gMSG_REPL_RESPONSE, nil)
+        return
+    }
+    id := j.GetInt64("LastLogId")
+    n.dmutex.Lock()
+    n.clearLocalData()
+    n.loadDataSnapshot(j)
+    n.setLastLogId(id)
+    // 快照之前的日志均不存在，因此快照logid即为压缩点
+    if err := n.saveCompactLogId(id); err != nil {
+        glog.Error("saving compact logid error:", err)
+    }
+    n.setCompactLogId(id)
+    n.dmutex.Unlock()
+    n.saveDataToFile()
+    glog.Printfln("snapshot installed from %s, logid: %d", msg.Info.Name, id)
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, nil)
+}
@@ -0,0 +1,192 @@
+// 应用选举
+// 应用实例通过会话竞选指定名称的选举，选举基于分布式锁实现，获得选举锁的会话即为当选者，
+// 当选信息以绑定会话的键值(gELECTION_KEY_PREFIX + 选举名称)保存在KV中，当选者会话失效时当选信息自动删除，并由下一个等待的会话当选；
+// 等待会话当选后公布的信息记录在选举锁中，选举锁交接时由leader将新当选者的当选信息写入同一日志项，
+// 因此即使等待的竞选请求已经超时返回，锁交接的同时当选信息也会更新，不会出现持有选举锁却没有当选信息的情况；
+// 观察者通过监听该键值的变化获知当选者的变化，该前缀下的键值及锁只能通过选举接口修改
+package dister
+
+import (
+    "net"
+    "errors"
+    "strings"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// 竞选，给定timeout时阻塞等待直到当选或者超时，当选者重复竞选时更新公布的信息
+func (n *Node) onMsgReplElectionCampaign(conn net.Conn, msg *Msg) {
+    var req ElectionRequest
+    if n.getRaftRole() != gROLE_RAFT_LEADER || gjson.DecodeTo(msg.Body, &req) != nil || req.Name == "" {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+        return
+    }
+    if req.Timeout > gLOCK_WAIT_TIMEOUT_MAX {
+        req.Timeout = gLOCK_WAIT_TIMEOUT_MAX
+    }
+    origin   := n.getLogOriginFromMsg(msg)
+    lreq     := &LockRequest{Name: getElectionKey(req.Name), Session: req.Session, Timeout: req.Timeout, Value: req.Value}
+    res, err := n.acquireLock(lreq, origin)
+    if err == nil && !res.Acquired && req.Timeout > 0 {
+        res, err = n.waitLock(lreq, origin)
+    }
+    // 获得选举锁时当选信息已经写入，当选者重复竞选并且公布的信息有变化时才需要更新
+    if err == nil && res.Acquired {
+        if e := n.getElection(req.Name); e.Session != req.Session || e.Value != req.Value {
+            err = n.proclaimElection(&req, origin)
+        }
+    }
+    if err != nil {
+        n.sendMsg(conn, gMSG_REPL_FAILED, []byte(err.Error()))
+        return
+    }
+    b, _ := gjson.Encode(n.getElection(req.Name))
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
+}
+
+// 退选，删除当选信息并释放选举锁，等待中的会话调用时表示退出竞选
+func (n *Node) onMsgReplElectionResign(conn net.Conn, msg *Msg) {
+    var req ElectionRequest
+    if n.getRaftRole() != gROLE_RAFT_LEADER || gjson.DecodeTo(msg.Body, &req) != nil || req.Name == "" {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+        return
+    }
+    origin := n.getLogOriginFromMsg(msg)
+    err    := n.withdrawElection(&req, origin)
+    if err == nil {
+        err = n.releaseLock(&LockRequest{Name: getElectionKey(req.Name), Session: req.Session}, origin)
+    }
+    if err != nil {
+        n.sendMsg(conn, gMSG_REPL_FAILED, []byte(err.Error()))
+    } else {
+        n.sendMsg(conn, gMSG_REPL_RESPONSE, nil)
+    }
+}
+
+// 用于API接口的选举观察(client节点的observe请求)，阻塞直到当选信息变化或者超时
+func (n *Node) onMsgApiElectionObserve(conn net.Conn, msg *Msg) {
+    var election *Election
+    if j, err := gjson.DecodeToJson(msg.Body); err == nil {
+        election = n.observeElection(j.GetString("name"), j.GetInt64("logid"), j.GetInt64("timeout"))
+    } else {
+        election = &Election{LogId: n.getLastLogId()}
+    }
+    b, _ := gjson.Encode(election)
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
+}
+
+// 由leader写入当选信息，调用方需要已经持有选举锁
+func (n *Node) proclaimElection(req *ElectionRequest, origin *LogOrigin) error {
+    n.dmutex.Lock()
+    defer n.dmutex.Unlock()
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        return errors.New("leader changed, please try again")
+    }
+    // 在获取数据锁的过程中会话可能已经失效，因此需要再次判断
+    if lock, ok := n.getLock(getElectionKey(req.Name)); !ok || lock.Owner != req.Session {
+        return errors.New("election lost by session: " + req.Session)
+    }
+    items := makeElectionWinner(getElectionKey(req.Name), req.Session, req.Value)
+    if err := n.checkKvQuota(items.Items, nil); err != nil {
+        return err
+    }
+    if _, ok := n.commitLogEntry(gMSG_REPL_DATA_SET_SESSION, items, origin); !ok {
+        return errors.New("election proclaiming failed, please try again")
+    }
+    return nil
+}
+
+// 由leader删除当选信息，当选信息不属于该会话时不做处理
+func (n *Node) withdrawElection(req *ElectionRequest, origin *LogOrigin) error {
+    n.dmutex.Lock()
+    defer n.dmutex.Unlock()
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        return errors.New("leader changed, please try again")
+    }
+    key := getElectionKey(req.Name)
+    if meta, ok := n.getKvMeta(key); !ok || meta.Session != req.Session {
+        return nil
+    }
+    if _, ok := n.commitLogEntry(gMSG_REPL_DATA_REMOVE, []interface{}{key}, origin); !ok {
+        return errors.New("election resigning failed, please try again")
+    }
+    return nil
+}
+
+// 阻塞观察当选信息的变化，直到当选信息变化或者超时(毫秒)，当logid<=0时立即返回当前的当选信息
+func (n *Node) observeElection(name string, logid int64, timeout int64) *Election {
+    if logid > 0 {
+        logid = n.watchData(getElectionKey(name), false, logid, timeout).LogId
+    } else {
+        logid = n.getLastLogId()
+    }
+    election      := n.getElection(name)
+    election.LogId = logid
+    return election
+}
+
+// 获取当前的当选信息
+func (n *Node) getElection(name string) *Election {
+    key      := getElectionKey(name)
+    election := &Election {
+        Name  : name,
+        LogId : n.getLastLogId(),
+    }
+    if meta, ok := n.getKvMeta(key); ok && meta.Session != "" {
+        election.Session = meta.Session
+        election.Value   = n.DataMap.Get(key)
+        if lock, ok := n.getLock(key); ok && lock.Owner == meta.Session {
+            election.Token = lock.Token
+        }
+    }
+    return election
+}
+
+// 获取选举在KV中的键名，同时也是选举锁的名称
+func getElectionKey(name string) string {
+    return gELECTION_KEY_PREFIX + name
+}
+
+// 判断键名(或者锁名称)是否属于选举，该前缀下的键值及锁由选举维护，不允许通过KV及锁接口修改
+func isElectionKey(k string) bool {
+    return strings.HasPrefix(k, gELECTION_KEY_PREFIX)
+}
+
+// 检查写入的键名是否属于选举
+func checkElectionKeys(keys ...string) error {
+    for _, k := range keys {
+        if isElectionKey(k) {
+            return errors.New("keys with prefix " + gELECTION_KEY_PREFIX + " are reserved for election: " + k)
+        }
+    }
+    return nil
+}
+
+// 生成当选信息，即绑定当选会话的选举键值
+func makeElectionWinner(key string, session string, value string) KvSessionItems {
+    return KvSessionItems {
+        Items   : map[string]string{key: value},
+        Session : session,
+    }
+}
+
+// 获取会话释放选举锁之后新当选者的当选信息，调用方需要持有dmutex锁
+func (n *Node) getNextElectionWinner(lock Lock, session string) (KvSessionItems, bool) {
+    if !isElectionKey(lock.Name) {
+        return KvSessionItems{}, false
+    }
+    next := n.getNextLockOwner(lock, session)
+    if next == "" {
+        return KvSessionItems{}, false
+    }
+    return makeElectionWinner(lock.Name, next, lock.Values[next]), true
+}
+
+// 执行日志项中的当选信息写入，需要在锁交接之后执行
+func (n *Node) applyElectionWinners(id int64, winners []KvSessionItems) {
+    for _, w := range winners {
+        for k, v := range w.Items {
+            n.setData(k, v)
+            n.updateKvMeta(k, id, 0, w.Session)
+        }
+    }
+}
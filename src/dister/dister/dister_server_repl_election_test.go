@@ -0,0 +1,54 @@
+package dister
+
+import (
+    "testing"
+)
+
+// 选举锁交接时新当选者的当选信息与锁在同一日志项中写入，不依赖等待中的竞选请求
+func TestElectionWinnerOnLockTransfer(t *testing.T) {
+    n   := NewServer()
+    key := getElectionKey("e")
+    n.Sessions.Set("s1", Session{Id: "s1"})
+    n.Sessions.Set("s2", Session{Id: "s2"})
+    n.Sessions.Set("s3", Session{Id: "s3"})
+
+    n.applyLockAcquire(1, key, "s1", "v1")
+    n.applyElectionWinners(1, []KvSessionItems{makeElectionWinner(key, "s1", "v1")})
+    n.applyLockAcquire(2, key, "s2", "v2")
+    n.applyLockAcquire(3, key, "s3", "v3")
+    if e := n.getElection("e"); e.Session != "s1" || e.Value != "v1" || e.Token != 1 {
+        t.Fatalf("unexpected election: %+v", e)
+    }
+    // 等待者退出时不影响当选者，并清除其当选信息
+    lock, _ := n.getLock(key)
+    if _, ok := n.getNextElectionWinner(lock, "s3"); ok {
+        t.Error("waiter leaving should not produce a winner")
+    }
+    n.applyLockRelease(4, key, "s3")
+    if lock, _ := n.getLock(key); len(lock.Values) != 1 || lock.Values["s2"] != "v2" {
+        t.Errorf("unexpected lock values: %v", lock.Values)
+    }
+    // 当选者释放时交给下一个等待者，新当选者的当选信息同时写入
+    lock, _ = n.getLock(key)
+    winner, ok := n.getNextElectionWinner(lock, "s1")
+    if !ok || winner.Session != "s2" || winner.Items[key] != "v2" {
+        t.Fatalf("unexpected winner: %+v", winner)
+    }
+    n.applyLockRelease(5, key, "s1")
+    n.applyElectionWinners(5, []KvSessionItems{winner})
+    if e := n.getElection("e"); e.Session != "s2" || e.Value != "v2" || e.Token != 5 {
+        t.Errorf("unexpected election: %+v", e)
+    }
+    if lock, _ := n.getLock(key); len(lock.Values) != 0 {
+        t.Errorf("unexpected lock values: %v", lock.Values)
+    }
+}
+
+func TestCheckElectionKeys(t *testing.T) {
+    if checkElectionKeys("a", "b/c") != nil {
+        t.Error("normal keys should be allowed")
+    }
+    if checkElectionKeys("a", getElectionKey("e")) == nil {
+        t.Error("election keys should be rejected")
+    }
+}
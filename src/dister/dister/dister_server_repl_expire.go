@@ -0,0 +1,57 @@
+// 键值过期处理
+// 过期删除只由leader执行，并且通过普通的gMSG_REPL_DATA_REMOVE日志进行删除，
+// 以保证follower、数据文件以及日志文件的数据一致性
+package dister
+
+import (
+    "time"
+    "gitee.com/johng/gf/g/os/glog"
+    "gitee.com/johng/gf/g/os/gtime"
+)
+
+// 定期检查并删除过期的键值，注意：***仅leader需要执行***
+func (n *Node) autoExpireData() {
+    for {
+        if n.getRaftRole() == gROLE_RAFT_LEADER && n.DataExpire.Size() > 0 {
+            n.removeExpiredData()
+        }
+        time.Sleep(gLOG_REPL_EXPIRE_INTERVAL * time.Millisecond)
+    }
+}
+
+// 删除已过期的键值，每次最多删除10000条，剩余的在下一次检查时删除
+func (n *Node) removeExpiredData() {
+    now  := gtime.Millisecond()
+    keys := make([]string, 0)
+    for k, v := range *n.DataExpire.Clone() {
+        if v.(int64) <= now {
+            keys = append(keys, k)
+            if len(keys) == 10000 {
+                break
+            }
+        }
+    }
+    if len(keys) == 0 {
+        return
+    }
+    n.dmutex.Lock()
+    defer n.dmutex.Unlock()
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        return
+    }
+    // 在获取锁的过程中键值可能已经被重新设置，因此需要再次判断
+    items := make([]interface{}, 0, len(keys))
+    for _, k := range keys {
+        if n.isKvExpired(k) {
+            items = append(items, k)
+        }
+    }
+    if len(items) == 0 {
+        return
+    }
+    if _, ok := n.commitLogEntry(gMSG_REPL_DATA_REMOVE, items, n.makeLogOrigin("key expired")); ok {
+        glog.Debugfln("removed %d expired keys", len(items))
+    } else {
+        glog.Debugfln("removing %d expired keys failed, retry later", len(items))
+    }
+}
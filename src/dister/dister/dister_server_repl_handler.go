@@ -33,16 +33,45 @@ func (n *Node) replTcpHandler(conn net.Conn) {
         conn.Close()
         return
     }
+    // 拒绝任期过期的消息，例如已被取代的旧leader发送的数据同步请求
+    if n.rejectStaleTermMsg(conn, msg, gMSG_REPL_TERM_EXPIRED) {
+        n.replTcpHandler(conn)
+        return
+    }
     switch msg.Head {
         case gMSG_REPL_DATA_SET:                    n.onMsgReplDataSet(conn, msg)
         case gMSG_REPL_DATA_REMOVE:                 n.onMsgReplDataRemove(conn, msg)
+        case gMSG_REPL_DATA_CAS:                    n.onMsgReplDataCas(conn, msg)
+        case gMSG_REPL_DATA_SET_TTL:                n.onMsgReplDataSetTtl(conn, msg)
+        case gMSG_REPL_DATA_SET_SESSION:            n.onMsgReplDataSetSession(conn, msg)
+        case gMSG_REPL_DATA_TXN:                    n.onMsgReplDataTxn(conn, msg)
+        case gMSG_REPL_LOCK_ACQUIRE:                n.onMsgReplLockAcquire(conn, msg)
+        case gMSG_REPL_LOCK_RELEASE:                n.onMsgReplLockRelease(conn, msg)
+        case gMSG_API_LOCK_GET:                     n.onMsgApiLockGet(conn, msg)
+        case gMSG_REPL_ELECTION_CAMPAIGN:           n.onMsgReplElectionCampaign(conn, msg)
+        case gMSG_REPL_ELECTION_RESIGN:             n.onMsgReplElectionResign(conn, msg)
+        case gMSG_API_ELECTION_OBSERVE:             n.onMsgApiElectionObserve(conn, msg)
+        case gMSG_API_READ_INDEX:                   n.onMsgApiReadIndex(conn, msg)
+        case gMSG_API_DATA_IMPORT:                  n.onMsgApiDataImport(conn, msg)
+        case gMSG_REPL_SESSION_CREATE:              n.onMsgReplSessionCreate(conn, msg)
+        case gMSG_REPL_SESSION_DESTROY:             n.onMsgReplSessionDestroy(conn, msg)
+        case gMSG_API_SESSION_GET:                  n.onMsgApiSessionGet(conn, msg)
+        case gMSG_API_SESSION_RENEW:                n.onMsgApiSessionRenew(conn, msg)
         case gMSG_REPL_DATA_APPENDENTRY:            n.onMsgReplDataAppendEntry(conn, msg)
         case gMSG_REPL_DATA_REPLICATION:            n.onMsgReplDataReplication(conn, msg)
+        case gMSG_REPL_SNAPSHOT_INSTALL:            n.onMsgReplSnapshotInstall(conn, msg)
         case gMSG_REPL_PEERS_UPDATE:                n.onMsgReplPeersUpdate(conn, msg)
         case gMSG_REPL_SERVICE_UPDATE:              n.onMsgReplServiceUpdate(conn, msg)
         case gMSG_REPL_VALID_LOGID_CHECK_FIX:       n.onMsgReplValidLogIdCheckFix(conn, msg)
         case gMSG_REPL_CONFIG_FROM_FOLLOWER:        n.onMsgReplConfigFromFollower(conn, msg)
         case gMSG_API_DATA_GET:                     n.onMsgApiDataGet(conn, msg)
+        case gMSG_API_DATA_WATCH:                   n.onMsgApiDataWatch(conn, msg)
+        case gMSG_API_DATA_LIST:                    n.onMsgApiDataList(conn, msg)
+        case gMSG_API_DATA_META:                    n.onMsgApiDataMeta(conn, msg)
+        case gMSG_API_DATA_HISTORY:                 n.onMsgApiDataHistory(conn, msg)
+        case gMSG_API_AUDIT:                        n.onMsgApiAudit(conn, msg)
+        case gMSG_API_USAGE:                        n.onMsgApiUsage(conn, msg)
+        case gMSG_API_LEADER_TRANSFER:              n.onMsgApiLeaderTransfer(conn, msg)
         case gMSG_API_PEERS_ADD:                    n.onMsgApiPeersAdd(conn, msg)
         case gMSG_API_PEERS_REMOVE:                 n.onMsgApiPeersRemove(conn, msg)
         case gMSG_API_SERVICE_GET:                  n.onMsgApiServiceGet(conn, msg)
@@ -66,23 +95,67 @@ func (n *Node) onMsgApiDataGet(conn net.Conn, msg *Msg) {
     n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
 }
 
+// 用于API接口的数据查询(带元数据)
+func (n *Node) onMsgApiDataMeta(conn net.Conn, msg *Msg) {
+    b, _ := n.getDataWithMetaByApi(string(msg.Body))
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
+}
+
+// 用于API接口的数据历史查询
+func (n *Node) onMsgApiDataHistory(conn net.Conn, msg *Msg) {
+    var q KvHistoryQuery
+    var b []byte
+    if gjson.DecodeTo(msg.Body, &q) == nil {
+        b, _ = gjson.Encode(n.getDataHistory(q.Key, q.At))
+    }
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
+}
+
+// 用于API接口的写入审计查询
+func (n *Node) onMsgApiAudit(conn net.Conn, msg *Msg) {
+    var q AuditQuery
+    var b []byte
+    if gjson.DecodeTo(msg.Body, &q) == nil {
+        b, _ = gjson.Encode(n.getAuditRecords(&q))
+    }
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
+}
+
+// 用于API接口的数据列表查询
+func (n *Node) onMsgApiDataList(conn net.Conn, msg *Msg) {
+    var q KvQuery
+    var b []byte
+    if gjson.DecodeTo(msg.Body, &q) == nil {
+        b, _ = n.getDataListByApi(&q)
+    }
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
+}
+
+// 用于API接口的数据监听(client节点的watch请求)，阻塞直到数据变化或者超时
+func (n *Node) onMsgApiDataWatch(conn net.Conn, msg *Msg) {
+    var result *WatchResult
+    if j, err := gjson.DecodeToJson(msg.Body); err == nil {
+        result = n.watchData(j.GetString("k"), j.GetBool("prefix"), j.GetInt64("logid"), j.GetInt64("timeout"))
+    } else {
+        result = &WatchResult{n.getAppliedLogId(), make([]WatchEvent, 0), 0}
+    }
+    b, _ := gjson.Encode(result)
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
+}
+
 // kv设置，这里增加了一把数据锁，以保证请求的先进先出队列执行，因此写效率会有所降低
 func (n *Node) onMsgReplDataSet(conn net.Conn, msg *Msg) {
+    var errmsg []byte
     result := gMSG_REPL_RESPONSE
     if n.getRaftRole() == gROLE_RAFT_LEADER {
         n.dmutex.Lock()
         items, _ := gjson.Decode(msg.Body)
         // 由于锁机制在请求量大的情况下会造成请求排队阻塞，因此这里面还需要再判断一下当前节点角色，防止在阻塞过程中角色的转变
         if n.getRaftRole() == gROLE_RAFT_LEADER && items != nil {
-            var entry = LogEntry {
-                Id    : n.makeLogId(),
-                Act   : msg.Head,
-                Items : items,
-            }
-            if n.sendAppendLogEntryToPeers(&entry) {
-                n.LogList.PushFront(&entry)
-                n.saveLogEntry(&entry)
-            } else {
+            if err := n.checkKvQuotaByItems(msg.Head, items); err != nil {
+                result = gMSG_REPL_FAILED
+                errmsg = []byte(err.Error())
+            } else if _, ok := n.commitLogEntry(msg.Head, items, n.getLogOriginFromMsg(msg)); !ok {
                 result = gMSG_REPL_FAILED
             }
         } else {
@@ -95,7 +168,139 @@ func (n *Node) onMsgReplDataSet(conn net.Conn, msg *Msg) {
     if result == gMSG_REPL_FAILED {
         glog.Debugfln("data set failed, msg: %s", msg.Body)
     }
-    n.sendMsg(conn, result, nil)
+    n.sendMsg(conn, result, errmsg)
+}
+
+// 带过期时间的kv设置，过期时间点由leader根据生存时间计算，follower直接使用该时间点
+func (n *Node) onMsgReplDataSetTtl(conn net.Conn, msg *Msg) {
+    var t KvTtlItems
+    var errmsg []byte
+    result := gMSG_REPL_RESPONSE
+    if n.getRaftRole() == gROLE_RAFT_LEADER && gjson.DecodeTo(msg.Body, &t) == nil && len(t.Items) > 0 && t.Ttl > 0 {
+        n.dmutex.Lock()
+        if n.getRaftRole() == gROLE_RAFT_LEADER {
+            t.Expire = gtime.Millisecond() + t.Ttl*1000
+            if err := n.checkKvQuota(t.Items, nil); err != nil {
+                result = gMSG_REPL_FAILED
+                errmsg = []byte(err.Error())
+            } else if _, ok := n.commitLogEntry(msg.Head, t, n.getLogOriginFromMsg(msg)); !ok {
+                result = gMSG_REPL_FAILED
+            }
+        } else {
+            result = gMSG_REPL_FAILED
+        }
+        n.dmutex.Unlock()
+    } else {
+        result = gMSG_REPL_FAILED
+    }
+    if result == gMSG_REPL_FAILED {
+        glog.Debugfln("data set with ttl failed, msg: %s", msg.Body)
+    }
+    n.sendMsg(conn, result, errmsg)
+}
+
+// 检查gMSG_REPL_DATA_SET写入的键值是否超出配额，删除操作不需要检查
+func (n *Node) checkKvQuotaByItems(act int, items interface{}) error {
+    m, ok := items.(map[string]interface{})
+    if act != gMSG_REPL_DATA_SET || !ok {
+        return nil
+    }
+    set := make(map[string]string, len(m))
+    for k, v := range m {
+        set[k] = fmt.Sprintf("%v", v)
+    }
+    return n.checkKvQuota(set, nil)
+}
+
+// kv比较并设置(compare-and-swap)
+// 比较操作必须在leader的dmutex锁内执行，以保证比较与写入之间不会有其他的写入，即线性一致性；
+// 由于比较在leader上已经完成，写入的LogEntry是普通的gMSG_REPL_DATA_SET，follower直接执行即可
+func (n *Node) onMsgReplDataCas(conn net.Conn, msg *Msg) {
+    var cas KvCas
+    var res KvCasResult
+    var errmsg []byte
+    result := gMSG_REPL_RESPONSE
+    if n.getRaftRole() == gROLE_RAFT_LEADER && gjson.DecodeTo(msg.Body, &cas) == nil {
+        n.dmutex.Lock()
+        if n.getRaftRole() == gROLE_RAFT_LEADER {
+            res = n.compareKv(&cas)
+            if res.Succeeded {
+                if err := n.checkKvQuota(map[string]string{cas.Key: cas.Value}, nil); err != nil {
+                    result = gMSG_REPL_FAILED
+                    errmsg = []byte(err.Error())
+                } else if entry, ok := n.commitLogEntry(gMSG_REPL_DATA_SET, map[string]interface{}{cas.Key: cas.Value}, n.getLogOriginFromMsg(msg)); ok {
+                    res.LogId = entry.Id
+                } else {
+                    result = gMSG_REPL_FAILED
+                }
+            }
+        } else {
+            result = gMSG_REPL_FAILED
+        }
+        n.dmutex.Unlock()
+    } else {
+        result = gMSG_REPL_FAILED
+    }
+    if result == gMSG_REPL_FAILED {
+        glog.Debugfln("data cas failed, msg: %s", msg.Body)
+        n.sendMsg(conn, result, errmsg)
+    } else {
+        b, _ := gjson.Encode(res)
+        n.sendMsg(conn, result, b)
+    }
+}
+
+// 将给定的期望值与当前的键值进行比较，调用方需要持有dmutex锁
+func (n *Node) compareKv(cas *KvCas) KvCasResult {
+    // 已过期但尚未被删除的键值视为不存在，与读取保持一致
+    res := KvCasResult {
+        Succeeded : true,
+        Exist     : n.DataMap.Contains(cas.Key) && !n.isKvExpired(cas.Key),
+    }
+    if res.Exist {
+        res.Value = n.DataMap.Get(cas.Key)
+        if meta, ok := n.getKvMeta(cas.Key); ok {
+            res.ModifyId = meta.ModifyId
+        }
+    }
+    if cas.Prev != nil && (!res.Exist || *cas.Prev != res.Value) {
+        res.Succeeded = false
+    }
+    if cas.LogId != nil {
+        if *cas.LogId == 0 {
+            if res.Exist {
+                res.Succeeded = false
+            }
+        } else if !res.Exist || *cas.LogId != res.ModifyId {
+            res.Succeeded = false
+        }
+    }
+    return res
+}
+
+// 由leader生成LogEntry并发送到其他节点，成功后写入本地，调用方需要持有dmutex锁
+// gMSG_REPL_DATA_SET/gMSG_REPL_DATA_REMOVE的items必须是经过JSON解析的数据结构(map[string]interface{}或者[]interface{})，与follower保持一致，
+// 其他操作的items在使用时通过decodeLogEntryItems进行解析
+func (n *Node) commitLogEntry(act int, items interface{}, origin *LogOrigin) (*LogEntry, bool) {
+    var entry = LogEntry {
+        Id    : n.makeLogId(),
+        Act   : act,
+        Term  : n.getCurrentTerm(),
+        Items : items,
+    }
+    // 同一请求可能提交多个LogEntry，因此每个LogEntry使用独立的来源副本记录各自的提交时间
+    if origin != nil {
+        o           := *origin
+        o.Time       = gtime.Millisecond()
+        entry.Origin = &o
+    }
+    if n.sendAppendLogEntryToPeers(&entry) {
+        n.LogList.PushFront(&entry)
+        n.saveLogEntry(&entry)
+        n.updateCommitLogId()
+        return &entry, true
+    }
+    return nil, false
 }
 
 // 当Leader获取数据写入时，直接写入数据请求
@@ -109,6 +314,8 @@ func (n *Node) onMsgReplDataAppendEntry(conn net.Conn, msg *Msg) {
     err := gjson.DecodeTo(msg.Body, &entry)
     if msg.Info.LastLogId == n.getLastLogId() && n.getRaftRole() != gROLE_RAFT_LEADER && err == nil {
         n.dmutex.Lock()
+        // 前一条logid与leader匹配，新写入的LogEntry需要等待leader提交之后才会应用
+        n.updateMatchLogId(msg.Info.LastLogId)
         n.saveLogEntry(&entry)
         n.dmutex.Unlock()
     } else {
@@ -117,38 +324,67 @@ func (n *Node) onMsgReplDataAppendEntry(conn net.Conn, msg *Msg) {
     n.sendMsg(conn, result, nil)
 }
 
-// 发送数据操作到其他节点，保证有另外一个server节点成功，那么该请求便成功
-// 这里只处理server节点，client节点通过另外的数据同步线程进行数据同步
+// 发送数据操作到其他节点，根据写入请求的持久化级别保证足够数量的server节点成功(默认为多数派)，那么该请求便成功
+// 这里只处理投票成员(witness节点只接收日志元数据)，client节点通过另外的数据同步线程进行数据同步
 func (n *Node) sendAppendLogEntryToPeers(entry *LogEntry) bool {
-    // 获取存活的Server节点列表
-    list  := n.getAliveServerNodes()
-    total := int32(len(list))
-    if total == 0 {
+    servers, witnesses := n.getVoterPeersCount()
+    c, d      := n.getDurabilityAckCount(getLogEntryDurability(entry), servers, witnesses)
+    need      := int32(c)
+    needData  := int32(d)
+    // 不需要等待其他节点(leader级别的写入或者集群只有一个server节点)，由数据同步线程异步同步
+    if need == 0 {
         return true
     }
+    // 获取存活的投票成员列表，非投票的server节点由数据同步线程异步同步
+    list      := make([]NodeInfo, 0)
+    var totalData int32 = 0
+    for _, info := range n.getVoterPeers() {
+        if info.Status == gSTATUS_ALIVE {
+            list = append(list, info)
+            if info.Role != gROLE_WITNESS {
+                totalData++
+            }
+        }
+    }
+    total := int32(len(list))
+    if total < need || totalData < needData {
+        return false
+    }
 
     var doneCount int32 = 0 // 成功的请求数
     var failCount int32 = 0 // 失败的请求数
+    var doneData  int32 = 0 // server节点(存储数据)成功的请求数
+    var failData  int32 = 0 // server节点(存储数据)失败的请求数
     result    := true
-    entryb, _ := gjson.Encode(*entry)
+    entryb, _   := gjson.Encode(*entry)
+    witnessb, _ := gjson.Encode(makeWitnessLogEntry(entry))
     for _, v := range list {
         info := v
+        b    := entryb
+        if info.Role == gROLE_WITNESS {
+            b = witnessb
+        }
         go func(info *NodeInfo, entryb []byte) {
-            msg, err := n.sendAndReceiveMsgToNode(info, gPORT_REPL, gMSG_REPL_DATA_APPENDENTRY, entryb)
-            if err == nil && (msg != nil && msg.Head == gMSG_REPL_RESPONSE) {
+            if n.appendLogEntryToNode(info, entryb) {
+                if info.Role != gROLE_WITNESS {
+                    atomic.AddInt32(&doneData, 1)
+                }
                 atomic.AddInt32(&doneCount, 1)
             } else {
+                if info.Role != gROLE_WITNESS {
+                    atomic.AddInt32(&failData, 1)
+                }
                 atomic.AddInt32(&failCount, 1)
             }
-        }(&info, entryb)
+        }(&info, b)
     }
     // 等待执行结束，超时时间60秒
     timeout := gtime.Second() + 60
     for {
-        if atomic.LoadInt32(&doneCount) > 0 {
+        if atomic.LoadInt32(&doneCount) >= need && atomic.LoadInt32(&doneData) >= needData {
             result = true
             break;
-        } else if atomic.LoadInt32(&failCount) == total {
+        } else if total - atomic.LoadInt32(&failCount) < need || totalData - atomic.LoadInt32(&failData) < needData {
             result = false
             break;
         } else if gtime.Second() >= timeout {
@@ -161,24 +397,61 @@ func (n *Node) sendAppendLogEntryToPeers(entry *LogEntry) bool {
     return result
 }
 
-// 获取存活的Server节点数，并做缓存处理，以提高读取效率
-func (n *Node) getAliveServerNodes() []NodeInfo {
-    key    := "dister_cached_server_nodes"
-    result := gcache.Get(key)
-    if result != nil {
-        return result.([]NodeInfo)
-    } else {
-        list := make([]NodeInfo, 0)
-        for _, v := range n.Peers.Values() {
-            info := v.(NodeInfo)
-            if info.Status != gSTATUS_ALIVE || info.Role != gROLE_SERVER {
-                continue
-            }
-            list = append(list, info)
+// 发送LogEntry到投票成员，目标节点的日志与leader不一致导致写入失败时，先修复目标节点的日志再重试，
+// 避免leader/one级别的写入或者部分失败的写入导致之后的写入在数据同步线程修复之前全部失败
+func (n *Node) appendLogEntryToNode(info *NodeInfo, entryb []byte) bool {
+    conn := n.getConn(info.Ip, gPORT_REPL)
+    if conn == nil {
+        return false
+    }
+    defer conn.Close()
+    if n.checkConnInLocalNode(conn) {
+        n.Peers.Remove(info.Id)
+        return false
+    }
+    for i := 0; i < gLOG_REPL_APPEND_RETRY; i++ {
+        if n.sendMsg(conn, gMSG_REPL_DATA_APPENDENTRY, entryb) != nil {
+            return false
+        }
+        msg := n.receiveMsg(conn)
+        if msg == nil {
+            return false
+        }
+        if msg.Head == gMSG_REPL_RESPONSE {
+            return true
         }
-        gcache.Set(key, list, 1000)
-        return list
+        if msg.Head != gMSG_REPL_FAILED || !n.fixRemoteNodeLog(conn, info, msg.Info.LastLogId) {
+            return false
+        }
+    }
+    return false
+}
+
+// 修复与leader日志不一致的投票成员，logid为目标节点当前的LastLogId，返回修复之后是否可以重试写入：
+// 1. 日志落后(例如leader/one级别的写入尚未同步)时补齐缺失的日志；
+// 2. 日志分叉(例如部分失败的写入只在部分节点写入成功)时通过logid比对截断目标节点多余的日志，重试时再补齐；
+// 调用方持有dmutex锁，需要安装快照时(日志已被压缩或者witness节点日志分叉)无法在这里处理，交由数据同步线程
+func (n *Node) fixRemoteNodeLog(conn net.Conn, info *NodeInfo, logid int64) bool {
+    lastLogId := n.getLastLogId()
+    if logid == lastLogId || logid < n.getCompactLogId() {
+        return false
+    }
+    node          := *info
+    node.LastLogId = logid
+    if logid < lastLogId && n.isValidLogId(logid) {
+        n.updateDataToRemoteNode(conn, &node)
+        return true
     }
+    if info.Role == gROLE_WITNESS {
+        return false
+    }
+    n.checkAndFixNodeData(&node)
+    return true
+}
+
+// 获取集群多数派(quorum)的投票成员数，不区分节点是否存活
+func (n *Node) getQuorumCount() int {
+    return len(n.getVoters())/2 + 1
 }
 
 // Follower->Leader的配置同步
@@ -274,18 +547,37 @@ func (n *Node) saveLogEntry(entry *LogEntry) {
         glog.Errorfln("expired log entry, received:%d, current:%d", entry.Id, lastLogId)
         return
     }
+    // witness节点不存储数据
+    if n.getRole() == gROLE_WITNESS {
+        n.saveWitnessLogEntry(entry)
+        return
+    }
     // 首先记录日志(不做缓存，直接写入，防止数据丢失)
     n.saveLogEntryToFile(entry)
-    // 其次写入DataMap
-    n.saveLogEntryToVar(entry)
     // 保存最新的LogId到内存
     n.setLastLogId(entry.Id)
+    n.setLastLogTerm(entry.Term)
+    // 其次加入待应用列表，已提交的日志才写入DataMap
+    n.PendingLogEntries = append(n.PendingLogEntries, *entry)
+    n.applyCommittedLogEntries()
 }
 
 // 保存LogEntry到日志文件中
 func (n *Node) saveLogEntryToFile(entry *LogEntry) {
     b, _ := gjson.Encode(entry.Items)
-    c := fmt.Sprintf("%d,%d,%s\n", entry.Id, entry.Act, b)
+    c := fmt.Sprintf("%d,%d,%s", entry.Id, entry.Act, b)
+    // 写入来源及任期以制表符分隔追加在行尾(JSON编码后的内容不会包含制表符)，没有来源时来源为空
+    if entry.Origin != nil || entry.Term > 0 {
+        c += "\t"
+        if entry.Origin != nil {
+            o, _ := gjson.Encode(entry.Origin)
+            c    += string(o)
+        }
+        if entry.Term > 0 {
+            c += fmt.Sprintf("\t%d", entry.Term)
+        }
+    }
+    c += "\n"
     p := n.getLogEntryFileSavePathById(entry.Id)
     gfile.PutBinContentsAppend(p, []byte(c))
 }
@@ -295,14 +587,154 @@ func (n *Node) saveLogEntryToVar(entry *LogEntry) {
     switch entry.Act {
         case gMSG_REPL_DATA_SET:
             for k, v := range entry.Items.(map[string]interface{}) {
-                n.DataMap.Set(k, v.(string))
+                n.setData(k, v.(string))
+                n.updateKvMeta(k, entry.Id, 0, "")
             }
 
         case gMSG_REPL_DATA_REMOVE:
             for _, v := range entry.Items.([]interface{}) {
-                n.DataMap.Remove(v.(string))
+                n.removeData(v.(string))
+                n.removeKvMeta(v.(string))
+            }
+
+        case gMSG_REPL_DATA_SET_TTL:
+            var t KvTtlItems
+            if err := n.decodeLogEntryItems(entry, &t); err != nil {
+                glog.Error(err)
+                break
+            }
+            for k, v := range t.Items {
+                n.setData(k, v)
+                n.updateKvMeta(k, entry.Id, t.Expire, "")
+            }
+
+        case gMSG_REPL_DATA_SET_SESSION:
+            var t KvSessionItems
+            if err := n.decodeLogEntryItems(entry, &t); err != nil {
+                glog.Error(err)
+                break
+            }
+            for k, v := range t.Items {
+                n.setData(k, v)
+                n.updateKvMeta(k, entry.Id, 0, t.Session)
+            }
+
+        case gMSG_REPL_DATA_TXN:
+            var t KvTxnItems
+            if err := n.decodeLogEntryItems(entry, &t); err != nil {
+                glog.Error(err)
+                break
+            }
+            for _, k := range t.Remove {
+                n.removeData(k)
+                n.removeKvMeta(k)
+            }
+            for k, v := range t.Set {
+                n.setData(k, v)
+                n.updateKvMeta(k, entry.Id, 0, "")
+            }
+
+        case gMSG_REPL_LOCK_ACQUIRE:
+            var t LockRequest
+            if err := n.decodeLogEntryItems(entry, &t); err != nil {
+                glog.Error(err)
+                break
+            }
+            n.applyLockAcquire(entry.Id, t.Name, t.Session, t.Value)
+            n.applyElectionWinners(entry.Id, t.Winners)
+
+        case gMSG_REPL_LOCK_RELEASE:
+            var t LockRequest
+            if err := n.decodeLogEntryItems(entry, &t); err != nil {
+                glog.Error(err)
+                break
             }
+            n.applyLockRelease(entry.Id, t.Name, t.Session)
+            n.applyElectionWinners(entry.Id, t.Winners)
+
+        case gMSG_REPL_SESSION_CREATE:
+            var session Session
+            if err := n.decodeLogEntryItems(entry, &session); err != nil {
+                glog.Error(err)
+                break
+            }
+            session.CreateId = entry.Id
+            n.Sessions.Set(session.Id, session)
+
+        case gMSG_REPL_SESSION_DESTROY:
+            var t SessionDestroyItems
+            if err := n.decodeLogEntryItems(entry, &t); err != nil {
+                glog.Error(err)
+                break
+            }
+            for _, k := range t.Keys {
+                n.removeData(k)
+                n.removeKvMeta(k)
+            }
+            n.Sessions.Remove(t.Id)
+            n.releaseLocksBySession(entry.Id, t.Id)
+            n.applyElectionWinners(entry.Id, t.Winners)
+
+        case gMSG_REPL_MEMBER_ADD, gMSG_REPL_MEMBER_REMOVE:
+            n.applyMemberChange(entry)
     }
+    // 通知KV数据监听对象
+    n.notifyWatchers(entry)
+}
+
+// 将LogEntry的Items解析到指定的数据结构中
+// Items可能是leader本地生成的数据结构，也可能是经过JSON解析的数据结构，因此统一通过JSON转换
+func (n *Node) decodeLogEntryItems(entry *LogEntry, v interface{}) error {
+    b, err := gjson.Encode(entry.Items)
+    if err != nil {
+        return err
+    }
+    return gjson.DecodeTo(b, v)
+}
+
+// 获取键值对的元数据
+func (n *Node) getKvMeta(k string) (KvMeta, bool) {
+    if r := n.DataMeta.Get(k); r != nil {
+        return r.(KvMeta), true
+    }
+    return KvMeta{}, false
+}
+
+// 键值被LogEntry修改后更新其元数据，键值不存在元数据时视为新创建的键值
+func (n *Node) updateKvMeta(k string, id int64, expire int64, session string) {
+    meta, ok := n.getKvMeta(k)
+    if !ok {
+        meta.CreateId = id
+    }
+    meta.ModifyId = id
+    meta.Version  = meta.Version + 1
+    meta.Expire   = expire
+    meta.Session  = session
+    n.setKvMeta(k, meta)
+}
+
+// 设置键值对的元数据，同时维护过期键名表
+func (n *Node) setKvMeta(k string, meta KvMeta) {
+    n.DataMeta.Set(k, meta)
+    if meta.Expire > 0 {
+        n.DataExpire.Set(k, meta.Expire)
+    } else {
+        n.DataExpire.Remove(k)
+    }
+}
+
+// 删除键值对的元数据
+func (n *Node) removeKvMeta(k string) {
+    n.DataMeta.Remove(k)
+    n.DataExpire.Remove(k)
+}
+
+// 判断键值是否已经过期(过期的键值会由leader通过日志删除，在删除之前对外不可见)
+func (n *Node) isKvExpired(k string) bool {
+    if r := n.DataExpire.Get(k); r != nil {
+        return r.(int64) <= gtime.Millisecond()
+    }
+    return false
 }
 
 // 数据同步，更新本地数据
@@ -331,6 +763,9 @@ func (n *Node) updateDataFromRemoteNode(conn net.Conn, msg *Msg) {
                     n.saveLogEntry(&entry)
                 }
             }
+            // 同步的LogEntry均来自leader的日志
+            n.updateMatchLogId(n.getLastLogId())
+            n.applyCommittedLogEntries()
             n.dmutex.Unlock()
         }
     }
@@ -342,9 +777,18 @@ func (n *Node) updateDataToRemoteNode(conn net.Conn, info *NodeInfo) {
     // 支持分批同步，如果数据量大，每一次增量同步大小不超过1万条
     logid := info.LastLogId
     if n.getLastLogId() > logid {
+        // 目标节点需要的日志已被压缩，无法进行增量同步，需要先安装数据快照
+        if logid < n.getCompactLogId() {
+            n.installSnapshotToRemoteNode(conn, info)
+            return
+        }
         // 不合法的logid，有可能是数据不一致(小概率事件)，也可能是不同集群节点进行合并(人为操作问题)
-        // 这个时候我们总认为Leader是正确的，对节点数据进行强制性覆盖
+        // 这个时候我们总认为Leader是正确的，对节点数据进行强制性覆盖，witness节点没有日志可以修复，直接安装快照
         if !n.isValidLogId(logid) {
+            if info.Role == gROLE_WITNESS {
+                n.installSnapshotToRemoteNode(conn, info)
+                return
+            }
             n.checkAndFixNodeData(info)
             return
         }
@@ -356,6 +800,9 @@ func (n *Node) updateDataToRemoteNode(conn net.Conn, info *NodeInfo) {
             if length > 0 {
                 glog.Debugfln("data incremental replication from %s to %s, start logid: %d, end logid: %d, size: %d", n.getName(), info.Name, list[0].Id, list[length-1].Id, length)
                 b, _ := gjson.Encode(list)
+                if info.Role == gROLE_WITNESS {
+                    b, _ = gjson.Encode(makeWitnessLogEntries(list))
+                }
                 if err := n.sendMsg(conn, gMSG_REPL_DATA_REPLICATION, b); err != nil {
                     glog.Error(err)
                     time.Sleep(time.Second)
@@ -477,6 +924,11 @@ func (n *Node) onMsgReplValidLogIdCheckFix(conn net.Conn, msg *Msg) {
 // 机制：将匹配的logid其后的内容去掉，通过另外数据自动同步线程进行更新
 func (n *Node) fixDataMapByLogId(logid int64) {
     glog.Printfln("data checking and fixing, found valid logid: %d", logid)
+    // 日志已被压缩时无法通过日志重建数据，清空本地数据后由leader安装快照
+    if n.getCompactLogId() > 0 {
+        n.resetLocalData()
+        return
+    }
     fromid := n.getLogEntryBatachNo(logid)*gLOGENTRY_FILE_SIZE*gLOGENTRY_RANDOM_ID_SIZE
     list   := n.getLogEntriesByLastLogId(fromid, int((logid - fromid)/gLOGENTRY_RANDOM_ID_SIZE), false)
     // 直接删除logid当前文件其后的存储文件
@@ -503,8 +955,10 @@ func (n *Node) fixDataMapByLogId(logid int64) {
     } else {
         fromid = 0
     }
+    n.dmutex.Lock()
     n.reloadDataMap()
     n.setLastLogId(fromid)
+    n.dmutex.Unlock()
 }
 
 
@@ -537,39 +991,27 @@ func (n *Node) updateServiceToRemoteNode(conn net.Conn) {
     }
 }
 
-// 新增节点,通过IP添加
+// 新增节点,通过IP添加，server节点作为投票成员加入，每次只变更一个成员，因此按顺序逐个提交
 func (n *Node) onMsgApiPeersAdd(conn net.Conn, msg *Msg) {
-    list := make([]string, 0)
+    list   := make([]string, 0)
+    result := make([]MemberChange, 0)
     gjson.DecodeTo(msg.Body, &list)
-    if list != nil && len(list) > 0 {
-        for _, ip := range list {
-            if n.Peers.Contains(ip) {
-                continue
-            }
-            glog.Printf("adding peer: %s\n", ip)
-            n.updatePeerInfo(NodeInfo{Id: ip, Ip: ip})
-        }
+    for _, ip := range list {
+        result = append(result, n.addMember(ip, n.getLogOriginFromMsg(msg)))
     }
-    n.sendMsg(conn, gMSG_REPL_RESPONSE, nil)
+    b, _ := gjson.Encode(result)
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
 }
 
-// 删除节点，目前通过IP删除，效率较低
+// 删除节点，可以通过节点ID、名称或者IP删除，投票成员按顺序逐个提交变更
 func (n *Node) onMsgApiPeersRemove(conn net.Conn, msg *Msg) {
-    list := make([]string, 0)
+    list   := make([]string, 0)
+    result := make([]MemberChange, 0)
     gjson.DecodeTo(msg.Body, &list)
-    if list != nil && len(list) > 0 {
-        peers := n.Peers.Values()
-        for _, ip := range list {
-            for _, v := range peers {
-                info := v.(NodeInfo)
-                if ip == info.Ip {
-                    glog.Printf("removing peer: %s, ip: %s\n", info.Name, info.Ip)
-                    n.Peers.Remove(info.Id)
-                    break
-                }
-            }
-        }
+    for _, node := range list {
+        result = append(result, n.removeMember(node, n.getLogOriginFromMsg(msg)))
     }
-    n.sendMsg(conn, gMSG_REPL_RESPONSE, nil)
+    b, _ := gjson.Encode(result)
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
 }
 
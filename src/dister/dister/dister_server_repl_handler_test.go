@@ -0,0 +1,44 @@
+package dister
+
+import (
+    "testing"
+    "gitee.com/johng/gf/g/os/gtime"
+)
+
+// 已过期但尚未被leader删除的键值在比较时视为不存在
+func TestCompareKvExpired(t *testing.T) {
+    n := NewServer()
+    n.setData("k", "v")
+    n.setKvMeta("k", KvMeta{CreateId: 5, ModifyId: 5, Version: 1, Expire: gtime.Millisecond() - 1000})
+    prev  := "v"
+    logid := int64(5)
+    if res := n.compareKv(&KvCas{Key: "k", Value: "v2", Prev: &prev}); res.Succeeded || res.Exist {
+        t.Errorf("expired key should not match prev: %+v", res)
+    }
+    if res := n.compareKv(&KvCas{Key: "k", Value: "v2", LogId: &logid}); res.Succeeded {
+        t.Errorf("expired key should not match logid: %+v", res)
+    }
+    zero := int64(0)
+    if res := n.compareKv(&KvCas{Key: "k", Value: "v2", LogId: &zero}); !res.Succeeded {
+        t.Errorf("expired key should be treated as absent: %+v", res)
+    }
+    n.setKvMeta("k", KvMeta{CreateId: 5, ModifyId: 5, Version: 1})
+    if res := n.compareKv(&KvCas{Key: "k", Value: "v2", Prev: &prev}); !res.Succeeded || !res.Exist {
+        t.Errorf("unexpired key should match prev: %+v", res)
+    }
+}
+
+// 事务比较同样将已过期的键值视为不存在
+func TestCompareTxnExpired(t *testing.T) {
+    n := NewServer()
+    n.setData("k", "v")
+    n.setKvMeta("k", KvMeta{CreateId: 5, ModifyId: 5, Version: 1, Expire: gtime.Millisecond() - 1000})
+    value := "v"
+    zero  := int64(0)
+    if n.compareTxn(&KvTxnCompare{Key: "k", Op: "=", Value: &value}) {
+        t.Error("expired key should not match value")
+    }
+    if !n.compareTxn(&KvTxnCompare{Key: "k", Op: "=", LogId: &zero}) {
+        t.Error("expired key should have modify logid 0")
+    }
+}
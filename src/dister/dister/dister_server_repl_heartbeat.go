@@ -17,6 +17,9 @@ import (
     "gitee.com/johng/gf/g/encoding/gjson"
 )
 
+// 日志文件中每一行的格式："logid,操作类型,数据[\t来源[\t任期]]"
+var gLOGENTRY_LINE_REGEXP = regexp.MustCompile(`^(\d+),(\d+),([^\t]+)(?:\t([^\t]*))?(?:\t(\d+))?$`)
+
 // leader到其他节点的数据同步监听
 func (n *Node) replicationHandler() {
     // 数据同步检测
@@ -30,15 +33,24 @@ func (n *Node) replicationHandler() {
 
     // LogList定期清理
     go n.autoCleanLogList()
+
+    // 过期键值定期清理
+    go n.autoExpireData()
+
+    // 失效会话定期清理
+    go n.autoExpireSessions()
+
+    // 日志定期压缩
+    go n.autoCompactLog()
 }
 
-// 日志自动同步检查，这里只同步数据给server，client节点不需要存储任何数据
+// 日志自动同步检查，这里只同步数据给server(witness节点只同步日志元数据)，client节点不需要存储任何数据
 func (n *Node) dataReplicationLoop() {
     for {
         if n.getRaftRole() == gROLE_RAFT_LEADER {
             for _, v := range n.Peers.Values() {
                 info := v.(NodeInfo)
-                if info.Role != gROLE_SERVER || info.Status != gSTATUS_ALIVE || info.Id == n.getId() {
+                if !isVoterRole(info.Role) || info.Status != gSTATUS_ALIVE || info.Id == n.getId() {
                     continue
                 }
                 // 需要同步时重新创建链接，同步完毕则关闭
@@ -65,14 +77,14 @@ func (n *Node) dataReplicationLoop() {
 }
 
 // Service自动同步检测
-// 注意：这里只同步数据给server，client节点不需要存储任何数据
+// 注意：这里只同步数据给server，client节点不需要存储任何数据，monitor节点只在内存中保存用于监控服务健康状态
 func (n *Node) serviceReplicationLoop() {
     for {
         if n.getRaftRole() == gROLE_RAFT_LEADER {
             for _, v := range n.Peers.Values() {
                 info := v.(NodeInfo)
                 //glog.Printf("%v: %v <= %v\n", info.Ip, n.getLastServiceLogId(), info.LastServiceLogId)
-                if info.Role != gROLE_SERVER || info.Status != gSTATUS_ALIVE || n.getLastServiceLogId() <= info.LastServiceLogId {
+                if (info.Role != gROLE_SERVER && info.Role != gROLE_MONITOR) || info.Status != gSTATUS_ALIVE || n.getLastServiceLogId() <= info.LastServiceLogId {
                     continue
                 }
                 go func(info *NodeInfo) {
@@ -176,8 +188,16 @@ func (n *Node) getLogEntryListFromFileByLogId(logid int64, max int, check bool)
     if logid == 0 {
         match = true
     }
+    // 压缩点之前的日志已不存在，校验模式下无法找到该logid，否则从压缩点之后的第一个日志文件开始读取
+    if compactId := n.getCompactLogId(); logid < compactId {
+        if check {
+            return make([]LogEntry, 0)
+        }
+        id    = compactId
+        match = true
+    }
     array  := make([]LogEntry, 0)
-    reg, _ := regexp.Compile(`^(\d+),(\d+),(.+)$`)
+    reg    := gLOGENTRY_LINE_REGEXP
     for {
         // 确定数据文件
         path      := n.getLogEntryFileSavePathById(id)
@@ -205,14 +225,8 @@ func (n *Node) getLogEntryListFromFileByLogId(logid int64, max int, check bool)
                         match = true
                     } else if rid > logid {
                         if match {
-                            act, err := strconv.Atoi(results[2])
-                            items    := gjson.Decode(results[3])
-                            if err == nil && items != nil {
-                                array = append(array, LogEntry {
-                                    Id    : rid,
-                                    Act   : act,
-                                    Items : items,
-                                })
+                            if entry, ok := parseLogEntryLine(rid, results); ok {
+                                array = append(array, entry)
                             }
                         } else {
                             break;
@@ -240,10 +254,103 @@ func (n *Node) getLogEntryListFromFileByLogId(logid int64, max int, check bool)
     return array
 }
 
+// 解析日志文件中一行的正则匹配结果，行格式为"logid,操作类型,数据[\t来源[\t任期]]"
+func parseLogEntryLine(rid int64, results []string) (LogEntry, bool) {
+    act, err := strconv.Atoi(results[2])
+    items    := gjson.Decode(results[3])
+    if err != nil || items == nil {
+        return LogEntry{}, false
+    }
+    var origin *LogOrigin
+    if results[4] != "" {
+        origin = &LogOrigin{}
+        if gjson.DecodeTo([]byte(results[4]), origin) != nil {
+            origin = nil
+        }
+    }
+    // 旧版本的日志没有记录任期，此时任期为0
+    term, _ := strconv.ParseInt(results[5], 10, 64)
+    return LogEntry {
+        Id     : rid,
+        Act    : act,
+        Term   : term,
+        Items  : items,
+        Origin : origin,
+    }, true
+}
+
+// 读取指定批次日志文件中的所有LogEntry(升序)，文件不存在时返回false
+func (n *Node) getLogEntriesFromFileByBatchNo(no int64) ([]LogEntry, bool) {
+    file, err := gfile.OpenWithFlag(n.getLogEntryFileSavePathByBatchNo(no), os.O_RDONLY)
+    if err != nil {
+        return nil, false
+    }
+    defer file.Close()
+    array  := make([]LogEntry, 0)
+    buffer := bufio.NewReader(file)
+    for {
+        line, _, err := buffer.ReadLine()
+        if err != nil {
+            if err != io.EOF {
+                glog.Error(err)
+            }
+            break
+        }
+        // 可能是一个空换行
+        if len(line) < 10 {
+            continue
+        }
+        results := gLOGENTRY_LINE_REGEXP.FindStringSubmatch(string(line))
+        if results == nil {
+            break
+        }
+        rid, _ := strconv.ParseInt(results[1], 10, 64)
+        if entry, ok := parseLogEntryLine(rid, results); ok {
+            array = append(array, entry)
+        }
+    }
+    return array, true
+}
+
+// 从最新的日志开始逆序遍历本地日志(内存日志列表及日志文件)，f返回false时停止遍历，
+// 返回是否已遍历到本地最早的日志(之前的日志已被压缩或者不存在)
+func (n *Node) walkLogEntriesReverse(f func(entry *LogEntry) bool) bool {
+    minId := n.getLastLogId() + 1
+    for l := n.LogList.Front(); l != nil; l = l.Next() {
+        entry := *(l.Value.(*LogEntry))
+        if entry.Id >= minId {
+            continue
+        }
+        minId = entry.Id
+        if !f(&entry) {
+            return false
+        }
+    }
+    // logid的序号部分连续递增，日志文件按照批次连续存储，遇到不存在的文件即表示已到达最早的日志
+    for no := n.getLogEntryBatachNo(minId - 1); no >= 0; no-- {
+        list, ok := n.getLogEntriesFromFileByBatchNo(no)
+        if !ok {
+            break
+        }
+        for i := len(list) - 1; i >= 0; i-- {
+            if list[i].Id >= minId {
+                continue
+            }
+            entry := list[i]
+            minId  = entry.Id
+            if !f(&entry) {
+                return false
+            }
+        }
+    }
+    return true
+}
+
 // 由于在数据量比较大的情况下，会引起多次同步，因此必需判断给定的logid是否是一个合法的logid，以便后续进程能够保证同步是有效合理的
 // 升序查找
 func (n *Node) isValidLogId(id int64) bool {
-    if id == 0 {
+    // 安装快照的节点的logid即为其压缩点
+    if id == 0 || id == n.getCompactLogId() {
         return true
     }
     lastLogId := n.getLastLogId()
@@ -330,7 +437,8 @@ func (n *Node) getMinLogIdFromPeers() int64 {
     minLogId := n.getLastLogId()
     for _, v := range n.Peers.Values() {
         info := v.(NodeInfo)
-        if info.Status != gSTATUS_ALIVE {
+        // client节点不存储数据，不需要同步日志
+        if info.Status != gSTATUS_ALIVE || info.Role != gROLE_SERVER {
             continue
         }
         if minLogId == 0 || info.LastLogId < minLogId {
@@ -0,0 +1,79 @@
+package dister
+
+import (
+    "fmt"
+    "net"
+    "sort"
+    "gitee.com/johng/gf/g/os/glog"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// 批量导入kv，由leader比较差异后分批写入(每个LogEntry最多gKV_IMPORT_BATCH_SIZE个键值)，dry-run时只返回差异
+func (n *Node) onMsgApiDataImport(conn net.Conn, msg *Msg) {
+    var t KvImport
+    if n.getRaftRole() != gROLE_RAFT_LEADER || gjson.DecodeTo(msg.Body, &t) != nil {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+        return
+    }
+    n.dmutex.Lock()
+    defer n.dmutex.Unlock()
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+        return
+    }
+    res := KvImportResult {
+        Added   : make([]string, 0),
+        Changed : make([]KvImportChange, 0),
+        LogIds  : make([]int64, 0),
+    }
+    origin := n.getLogOriginFromMsg(msg)
+    keys   := make([]string, 0, len(t.Items))
+    for k, _ := range t.Items {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    // 配额检查针对整个导入内容，避免只导入了部分批次
+    if err := n.checkKvQuota(t.Items, nil); err != nil {
+        n.sendMsg(conn, gMSG_REPL_FAILED, []byte(err.Error()))
+        return
+    }
+    items := make(map[string]interface{})
+    for _, k := range keys {
+        v := t.Items[k]
+        if n.DataMap.Contains(k) && !n.isKvExpired(k) {
+            old := n.DataMap.Get(k)
+            if old == v {
+                res.Unchanged++
+                continue
+            }
+            res.Changed = append(res.Changed, KvImportChange{k, old, v})
+        } else {
+            res.Added = append(res.Added, k)
+        }
+        if !t.DryRun {
+            items[k] = v
+            if len(items) == gKV_IMPORT_BATCH_SIZE {
+                if !n.commitImportBatch(conn, items, &res, origin) {
+                    return
+                }
+                items = make(map[string]interface{})
+            }
+        }
+    }
+    if len(items) > 0 && !n.commitImportBatch(conn, items, &res, origin) {
+        return
+    }
+    b, _ := gjson.Encode(res)
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
+}
+
+// 写入一批导入的键值，失败时返回错误信息(包含已经写入的logid)，调用方需要持有dmutex锁
+func (n *Node) commitImportBatch(conn net.Conn, items map[string]interface{}, res *KvImportResult, origin *LogOrigin) bool {
+    if entry, ok := n.commitLogEntry(gMSG_REPL_DATA_SET, items, origin); ok {
+        res.LogIds = append(res.LogIds, entry.Id)
+        return true
+    }
+    glog.Debugfln("data import failed, committed batches: %d", len(res.LogIds))
+    n.sendMsg(conn, gMSG_REPL_FAILED, []byte(fmt.Sprintf("data import failed, committed logids: %v, please try again", res.LogIds)))
+    return false
+}
@@ -0,0 +1,266 @@
+// 分布式锁
+// 锁的获取与释放均通过日志同步，锁的持有者及等待者均为会话，会话失效时由会话销毁日志自动释放锁或者退出等待，
+// 锁释放时按照先进先出顺序将锁交给下一个仍然有效的等待会话，防护令牌(fencing token)为获得锁时的LogEntry ID；
+// 阻塞等待只在leader上进行，等待超时后leader通过释放日志将会话从等待队列中移除
+package dister
+
+import (
+    "net"
+    "time"
+    "errors"
+    "gitee.com/johng/gf/g/os/glog"
+    "gitee.com/johng/gf/g/os/gtime"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// 获取分布式锁，给定timeout时阻塞等待直到获得锁或者超时
+func (n *Node) onMsgReplLockAcquire(conn net.Conn, msg *Msg) {
+    var req LockRequest
+    if n.getRaftRole() != gROLE_RAFT_LEADER || gjson.DecodeTo(msg.Body, &req) != nil || req.Name == "" {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+        return
+    }
+    if req.Timeout > gLOCK_WAIT_TIMEOUT_MAX {
+        req.Timeout = gLOCK_WAIT_TIMEOUT_MAX
+    }
+    origin   := n.getLogOriginFromMsg(msg)
+    res, err := n.acquireLock(&req, origin)
+    if err == nil && !res.Acquired && req.Timeout > 0 {
+        res, err = n.waitLock(&req, origin)
+    }
+    if err != nil {
+        n.sendMsg(conn, gMSG_REPL_FAILED, []byte(err.Error()))
+        return
+    }
+    b, _ := gjson.Encode(res)
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
+}
+
+// 释放分布式锁，或者退出等待队列
+func (n *Node) onMsgReplLockRelease(conn net.Conn, msg *Msg) {
+    var req LockRequest
+    if n.getRaftRole() != gROLE_RAFT_LEADER || gjson.DecodeTo(msg.Body, &req) != nil || req.Name == "" {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+        return
+    }
+    if err := n.releaseLock(&req, n.getLogOriginFromMsg(msg)); err != nil {
+        n.sendMsg(conn, gMSG_REPL_FAILED, []byte(err.Error()))
+    } else {
+        n.sendMsg(conn, gMSG_REPL_RESPONSE, nil)
+    }
+}
+
+// 用于API接口的分布式锁查询
+func (n *Node) onMsgApiLockGet(conn net.Conn, msg *Msg) {
+    b, _ := n.getLockByApi(string(msg.Body))
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
+}
+
+// 由leader尝试获取锁，锁被其他会话持有时，如果需要等待那么将会话加入等待队列
+func (n *Node) acquireLock(req *LockRequest, origin *LogOrigin) (*LockResult, error) {
+    n.dmutex.Lock()
+    defer n.dmutex.Unlock()
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        return nil, errors.New("leader changed, please try again")
+    }
+    if !n.Sessions.Contains(req.Session) {
+        return nil, errors.New("session not found: " + req.Session)
+    }
+    if lock, ok := n.getLock(req.Name); ok {
+        if lock.Owner == req.Session || req.Timeout <= 0 || containsString(lock.Waiters, req.Session) {
+            return n.getLockResult(req.Name, req.Session), nil
+        }
+    }
+    item := LockRequest{Name: req.Name, Session: req.Session}
+    // 选举锁记录会话当选后公布的信息，锁空闲时会话直接当选，当选信息与锁的获取在同一日志项中写入
+    if isElectionKey(req.Name) {
+        if err := n.checkKvQuota(map[string]string{req.Name: req.Value}, nil); err != nil {
+            return nil, err
+        }
+        item.Value = req.Value
+        if _, ok := n.getLock(req.Name); !ok {
+            item.Winners = []KvSessionItems{makeElectionWinner(req.Name, req.Session, req.Value)}
+        }
+    }
+    if _, ok := n.commitLogEntry(gMSG_REPL_LOCK_ACQUIRE, item, origin); !ok {
+        return nil, errors.New("lock acquiring failed, please try again")
+    }
+    return n.getLockResult(req.Name, req.Session), nil
+}
+
+// 由leader阻塞等待锁，超时后将会话从等待队列中移除
+func (n *Node) waitLock(req *LockRequest, origin *LogOrigin) (*LockResult, error) {
+    deadline := gtime.Millisecond() + req.Timeout
+    for gtime.Millisecond() < deadline {
+        time.Sleep(gLOCK_WAIT_CHECK_INTERVAL * time.Millisecond)
+        if n.getRaftRole() != gROLE_RAFT_LEADER {
+            return nil, errors.New("leader changed, please try again")
+        }
+        res := n.getLockResult(req.Name, req.Session)
+        if res.Acquired || !containsString(res.Waiters, req.Session) {
+            // 获得锁，或者会话已失效退出了等待队列
+            return res, nil
+        }
+    }
+    n.dmutex.Lock()
+    defer n.dmutex.Unlock()
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        return nil, errors.New("leader changed, please try again")
+    }
+    // 在获取数据锁的过程中可能已经获得锁，因此需要再次判断
+    if lock, ok := n.getLock(req.Name); ok && lock.Owner != req.Session && containsString(lock.Waiters, req.Session) {
+        if _, ok := n.commitLogEntry(gMSG_REPL_LOCK_RELEASE, n.makeLockReleaseItem(req.Name, req.Session), origin); !ok {
+            glog.Debugfln("removing session %s from lock waiters failed, lock: %s", req.Session, req.Name)
+        }
+    }
+    return n.getLockResult(req.Name, req.Session), nil
+}
+
+// 由leader释放锁，会话必须持有该锁或者在等待队列中
+func (n *Node) releaseLock(req *LockRequest, origin *LogOrigin) error {
+    n.dmutex.Lock()
+    defer n.dmutex.Unlock()
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        return errors.New("leader changed, please try again")
+    }
+    lock, ok := n.getLock(req.Name)
+    if !ok || (lock.Owner != req.Session && !containsString(lock.Waiters, req.Session)) {
+        return errors.New("lock not held by session: " + req.Session)
+    }
+    if _, ok := n.commitLogEntry(gMSG_REPL_LOCK_RELEASE, n.makeLockReleaseItem(req.Name, req.Session), origin); !ok {
+        return errors.New("lock releasing failed, please try again")
+    }
+    return nil
+}
+
+// 由leader生成锁释放的日志项，持有者释放选举锁时同时写入下一个当选者的当选信息，调用方需要持有dmutex锁
+func (n *Node) makeLockReleaseItem(name string, session string) LockRequest {
+    item := LockRequest{Name: name, Session: session}
+    if lock, ok := n.getLock(name); ok {
+        if winner, ok := n.getNextElectionWinner(lock, session); ok {
+            item.Winners = []KvSessionItems{winner}
+        }
+    }
+    return item
+}
+
+// 获取会话释放锁之后的下一个持有者，即等待队列中第一个仍然有效的会话，与applyLockRelease的交接规则一致
+func (n *Node) getNextLockOwner(lock Lock, session string) string {
+    if lock.Owner != session {
+        return ""
+    }
+    for _, v := range lock.Waiters {
+        if v != session && n.Sessions.Contains(v) {
+            return v
+        }
+    }
+    return ""
+}
+
+// 获取分布式锁
+func (n *Node) getLock(name string) (Lock, bool) {
+    if r := n.Locks.Get(name); r != nil {
+        return r.(Lock), true
+    }
+    return Lock{}, false
+}
+
+// 获取指定会话对于锁的操作结果
+func (n *Node) getLockResult(name string, session string) *LockResult {
+    lock, ok := n.getLock(name)
+    if !ok {
+        lock = Lock{Name: name, Waiters: make([]string, 0)}
+    }
+    return &LockResult{lock.Owner != "" && lock.Owner == session, lock}
+}
+
+// 执行锁获取日志：锁空闲时会话获得锁，否则会话进入等待队列，选举锁同时记录等待会话当选后公布的信息
+func (n *Node) applyLockAcquire(id int64, name string, session string, value string) {
+    lock, ok := n.getLock(name)
+    if !ok {
+        n.Locks.Set(name, Lock{name, session, id, make([]string, 0), nil})
+        return
+    }
+    if lock.Owner == session || containsString(lock.Waiters, session) {
+        return
+    }
+    waiters := make([]string, len(lock.Waiters), len(lock.Waiters) + 1)
+    copy(waiters, lock.Waiters)
+    lock.Waiters = append(waiters, session)
+    if isElectionKey(name) {
+        lock.Values = copyLockValues(lock.Values)
+        lock.Values[session] = value
+    }
+    n.Locks.Set(name, lock)
+}
+
+// 执行锁释放日志：持有者释放时将锁交给下一个有效的等待会话，等待者释放时退出等待队列
+func (n *Node) applyLockRelease(id int64, name string, session string) {
+    lock, ok := n.getLock(name)
+    if !ok {
+        return
+    }
+    waiters := make([]string, 0, len(lock.Waiters))
+    for _, v := range lock.Waiters {
+        if v != session {
+            waiters = append(waiters, v)
+        }
+    }
+    lock.Waiters = waiters
+    if lock.Owner == session {
+        lock.Owner = ""
+        for len(lock.Waiters) > 0 {
+            next        := lock.Waiters[0]
+            lock.Waiters = lock.Waiters[1:]
+            if n.Sessions.Contains(next) {
+                lock.Owner = next
+                lock.Token = id
+                break
+            }
+        }
+        if lock.Owner == "" {
+            n.Locks.Remove(name)
+            return
+        }
+    }
+    // 只保留仍在等待队列中的会话的当选信息
+    if len(lock.Values) > 0 {
+        values := make(map[string]string, len(lock.Waiters))
+        for _, v := range lock.Waiters {
+            if value, ok := lock.Values[v]; ok {
+                values[v] = value
+            }
+        }
+        lock.Values = values
+    }
+    n.Locks.Set(name, lock)
+}
+
+// 复制选举锁的当选信息表，锁以值的形式保存，修改前需要复制以免影响快照中的数据
+func copyLockValues(values map[string]string) map[string]string {
+    m := make(map[string]string, len(values) + 1)
+    for k, v := range values {
+        m[k] = v
+    }
+    return m
+}
+
+// 会话销毁时释放该会话持有的锁，并退出所有的等待队列
+func (n *Node) releaseLocksBySession(id int64, session string) {
+    for _, v := range n.Locks.Values() {
+        lock := v.(Lock)
+        if lock.Owner == session || containsString(lock.Waiters, session) {
+            n.applyLockRelease(id, lock.Name, session)
+        }
+    }
+}
+
+// 判断字符串是否在列表中
+func containsString(list []string, s string) bool {
+    for _, v := range list {
+        if v == s {
+            return true
+        }
+    }
+    return false
+}
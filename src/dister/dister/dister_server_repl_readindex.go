@@ -0,0 +1,76 @@
+// 读取一致性(ReadIndex)
+// stale      : 任意Server节点直接读取本地已应用的数据，可能读取到过期的数据；
+// default    : 与stale相同，Server节点读取本地数据，client节点从leader读取，保持引入一致性级别之前的行为；
+// consistent : leader记录当前的logid作为读取索引(read index)，通过多数派的只读探测确认自身身份后，
+//              等待本地数据应用到读取索引后读取，Server节点的follower同样等待本地数据应用到leader返回的读取索引后读取本地数据
+package dister
+
+import (
+    "net"
+    "time"
+    "errors"
+    "strconv"
+    "gitee.com/johng/gf/g/os/gtime"
+)
+
+// 获取读取索引，leader需要确认自身身份
+func (n *Node) onMsgApiReadIndex(conn net.Conn, msg *Msg) {
+    // 读取索引需要在确认身份之前记录
+    index := n.getLastLogId()
+    if !n.confirmLeadership() {
+        n.sendMsg(conn, gMSG_REPL_FAILED, []byte("leadership not confirmed, please try again"))
+        return
+    }
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, []byte(strconv.FormatInt(index, 10)))
+}
+
+// 根据读取一致性级别进行读取前的准备，返回true表示可以读取本地数据，false表示需要从leader读取
+func (n *Node) prepareRead(consistency string) (bool, error) {
+    local := n.getRole() == gROLE_SERVER
+    switch consistency {
+        case "", "default", "stale":
+            return local, nil
+
+        case "consistent":
+            if n.getRaftRole() == gROLE_RAFT_LEADER {
+                index := n.getLastLogId()
+                if !n.confirmLeadership() {
+                    return false, errors.New("leadership not confirmed, please try again")
+                }
+                // 刚成为leader时可能还有尚未应用的日志
+                if !n.waitAppliedLogId(index, gREAD_INDEX_WAIT_TIMEOUT) {
+                    return false, errors.New("timeout waiting for local data to be applied, please try again")
+                }
+                return true, nil
+            }
+            b, err := n.SendToLeader(gMSG_API_READ_INDEX, gPORT_REPL, nil)
+            if err != nil {
+                return false, err
+            }
+            index, err := strconv.ParseInt(string(b), 10, 64)
+            if err != nil {
+                return false, err
+            }
+            // client节点不存储数据，直接从leader读取
+            if !local {
+                return false, nil
+            }
+            if !n.waitAppliedLogId(index, gREAD_INDEX_WAIT_TIMEOUT) {
+                return false, errors.New("timeout waiting for local data to catch up with leader, please try again")
+            }
+            return true, nil
+    }
+    return false, errors.New("invalid consistency: " + consistency + ", should be stale, default or consistent")
+}
+
+// 等待本地数据应用到指定的logid(只写入日志而尚未应用的数据不可读)，超时(毫秒)返回false
+func (n *Node) waitAppliedLogId(logid int64, timeout int64) bool {
+    deadline := gtime.Millisecond() + timeout
+    for n.getAppliedLogId() < logid {
+        if gtime.Millisecond() >= deadline {
+            return false
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+    return true
+}
@@ -0,0 +1,175 @@
+// 会话及临时键值(ephemeral key)
+// 会话的创建与销毁、键值与会话的绑定均通过日志同步，会话数据与DataMap一起存储，因此leader切换后会话依然存在；
+// 会话续期只在leader内存中记录失效时间点，新的leader会为所有会话重新计算失效时间点(即给予一个会话保持时间的宽限期)
+package dister
+
+import (
+    "net"
+    "fmt"
+    "time"
+    "strings"
+    "gitee.com/johng/gf/g/os/glog"
+    "gitee.com/johng/gf/g/os/gtime"
+    "gitee.com/johng/gf/g/util/grand"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// 创建会话，会话ID由leader生成
+func (n *Node) onMsgReplSessionCreate(conn net.Conn, msg *Msg) {
+    var session Session
+    if n.getRaftRole() != gROLE_RAFT_LEADER || gjson.DecodeTo(msg.Body, &session) != nil {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+        return
+    }
+    if session.Ttl < gSESSION_TTL_MIN || session.Ttl > gSESSION_TTL_MAX {
+        n.sendMsg(conn, gMSG_REPL_FAILED, []byte(fmt.Sprintf("invalid session ttl: %d, should be between %d and %d seconds", session.Ttl, gSESSION_TTL_MIN, gSESSION_TTL_MAX)))
+        return
+    }
+    n.dmutex.Lock()
+    defer n.dmutex.Unlock()
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+        return
+    }
+    session.Id = n.makeSessionId()
+    if _, ok := n.commitLogEntry(gMSG_REPL_SESSION_CREATE, session, n.getLogOriginFromMsg(msg)); ok {
+        n.renewSession(session.Id)
+        b, _ := gjson.Encode(n.Sessions.Get(session.Id))
+        n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
+    } else {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+    }
+}
+
+// 销毁会话，同时删除绑定该会话的键值
+func (n *Node) onMsgReplSessionDestroy(conn net.Conn, msg *Msg) {
+    ids := make([]string, 0)
+    if n.getRaftRole() != gROLE_RAFT_LEADER || gjson.DecodeTo(msg.Body, &ids) != nil {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+        return
+    }
+    for _, id := range ids {
+        if !n.destroySession(id, n.getLogOriginFromMsg(msg)) {
+            n.sendMsg(conn, gMSG_REPL_FAILED, []byte("destroying session failed: " + id))
+            return
+        }
+    }
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, nil)
+}
+
+// 绑定会话的kv设置，会话必须存在
+func (n *Node) onMsgReplDataSetSession(conn net.Conn, msg *Msg) {
+    var t KvSessionItems
+    if n.getRaftRole() != gROLE_RAFT_LEADER || gjson.DecodeTo(msg.Body, &t) != nil || len(t.Items) == 0 {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+        return
+    }
+    n.dmutex.Lock()
+    defer n.dmutex.Unlock()
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+        return
+    }
+    if !n.Sessions.Contains(t.Session) {
+        n.sendMsg(conn, gMSG_REPL_FAILED, []byte("session not found: " + t.Session))
+        return
+    }
+    if err := n.checkKvQuota(t.Items, nil); err != nil {
+        n.sendMsg(conn, gMSG_REPL_FAILED, []byte(err.Error()))
+        return
+    }
+    if _, ok := n.commitLogEntry(msg.Head, t, n.getLogOriginFromMsg(msg)); ok {
+        n.sendMsg(conn, gMSG_REPL_RESPONSE, nil)
+    } else {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+    }
+}
+
+// 会话续期
+func (n *Node) onMsgApiSessionRenew(conn net.Conn, msg *Msg) {
+    id := string(msg.Body)
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+    } else if !n.renewSession(id) {
+        n.sendMsg(conn, gMSG_REPL_FAILED, []byte("session not found: " + id))
+    } else {
+        n.sendMsg(conn, gMSG_REPL_RESPONSE, nil)
+    }
+}
+
+// 用于API接口的会话查询
+func (n *Node) onMsgApiSessionGet(conn net.Conn, msg *Msg) {
+    b, _ := n.getSessionByApi(string(msg.Body))
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
+}
+
+// 生成会话ID
+func (n *Node) makeSessionId() string {
+    return strings.ToUpper(fmt.Sprintf("%x%04d", gtime.Millisecond(), grand.Rand(0, 9999)))
+}
+
+// 更新会话的失效时间点，仅leader调用
+func (n *Node) renewSession(id string) bool {
+    r := n.Sessions.Get(id)
+    if r == nil {
+        return false
+    }
+    n.SessionDeadline.Set(id, gtime.Millisecond() + r.(Session).Ttl*1000)
+    return true
+}
+
+// 由leader销毁会话，并删除绑定该会话的键值
+func (n *Node) destroySession(id string, origin *LogOrigin) bool {
+    n.dmutex.Lock()
+    defer n.dmutex.Unlock()
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        return false
+    }
+    if !n.Sessions.Contains(id) {
+        n.SessionDeadline.Remove(id)
+        return true
+    }
+    keys := make([]string, 0)
+    for k, v := range *n.DataMeta.Clone() {
+        if v.(KvMeta).Session == id {
+            keys = append(keys, k)
+        }
+    }
+    // 会话持有的选举锁交给下一个等待会话，新当选者的当选信息在同一日志项中写入
+    winners := make([]KvSessionItems, 0)
+    for _, v := range n.Locks.Values() {
+        if winner, ok := n.getNextElectionWinner(v.(Lock), id); ok {
+            winners = append(winners, winner)
+        }
+    }
+    if _, ok := n.commitLogEntry(gMSG_REPL_SESSION_DESTROY, SessionDestroyItems{id, keys, winners}, origin); ok {
+        n.SessionDeadline.Remove(id)
+        glog.Debugfln("session destroyed: %s, removed keys: %d", id, len(keys))
+        return true
+    }
+    return false
+}
+
+// 定期检查并销毁失效的会话，注意：***仅leader需要执行***
+func (n *Node) autoExpireSessions() {
+    for {
+        if n.getRaftRole() == gROLE_RAFT_LEADER {
+            now := gtime.Millisecond()
+            for _, v := range n.Sessions.Values() {
+                session := v.(Session)
+                r       := n.SessionDeadline.Get(session.Id)
+                if r == nil {
+                    // 新的leader没有会话的续期记录，给予一个会话保持时间的宽限期
+                    n.renewSession(session.Id)
+                } else if r.(int64) <= now {
+                    glog.Printfln("session expired: %s, name: %s", session.Id, session.Name)
+                    n.destroySession(session.Id, n.makeLogOrigin("session expired"))
+                }
+            }
+        } else if n.SessionDeadline.Size() > 0 {
+            // 不再是leader时清除续期记录，防止重新成为leader时使用过期的记录
+            n.SessionDeadline.Clear()
+        }
+        time.Sleep(gLOG_REPL_EXPIRE_INTERVAL * time.Millisecond)
+    }
+}
@@ -0,0 +1,143 @@
+// KV事务
+// 比较条件由leader在dmutex锁内进行判断，根据比较结果将Then或者Else操作列表合并为一个gMSG_REPL_DATA_TXN日志项，
+// 因此follower只需要直接执行合并后的设置与删除操作，多个键值的修改对外是原子可见的
+package dister
+
+import (
+    "net"
+    "errors"
+    "gitee.com/johng/gf/g/os/glog"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// kv事务
+func (n *Node) onMsgReplDataTxn(conn net.Conn, msg *Msg) {
+    var txn KvTxn
+    var res KvTxnResult
+    if n.getRaftRole() != gROLE_RAFT_LEADER || gjson.DecodeTo(msg.Body, &txn) != nil {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+        return
+    }
+    if err := checkKvTxn(&txn); err != nil {
+        n.sendMsg(conn, gMSG_REPL_FAILED, []byte(err.Error()))
+        return
+    }
+    n.dmutex.Lock()
+    defer n.dmutex.Unlock()
+    if n.getRaftRole() != gROLE_RAFT_LEADER {
+        n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+        return
+    }
+    res.Succeeded = true
+    for _, c := range txn.Compare {
+        if !n.compareTxn(&c) {
+            res.Succeeded = false
+            break
+        }
+    }
+    ops := txn.Then
+    if !res.Succeeded {
+        ops = txn.Else
+    }
+    // 没有任何操作时不需要写入日志
+    if items := makeKvTxnItems(ops); len(items.Set) > 0 || len(items.Remove) > 0 {
+        if err := n.checkKvQuota(items.Set, items.Remove); err != nil {
+            n.sendMsg(conn, gMSG_REPL_FAILED, []byte(err.Error()))
+            return
+        }
+        if entry, ok := n.commitLogEntry(gMSG_REPL_DATA_TXN, items, n.getLogOriginFromMsg(msg)); ok {
+            res.LogId = entry.Id
+        } else {
+            glog.Debugfln("data txn failed, msg: %s", msg.Body)
+            n.sendMsg(conn, gMSG_REPL_FAILED, nil)
+            return
+        }
+    }
+    b, _ := gjson.Encode(res)
+    n.sendMsg(conn, gMSG_REPL_RESPONSE, b)
+}
+
+// 判断事务比较条件是否成立，调用方需要持有dmutex锁
+func (n *Node) compareTxn(c *KvTxnCompare) bool {
+    // 已过期但尚未被删除的键值视为不存在，与读取保持一致
+    exist := n.DataMap.Contains(c.Key) && !n.isKvExpired(c.Key)
+    if c.Value != nil {
+        if !exist {
+            return false
+        }
+        value := n.DataMap.Get(c.Key)
+        switch c.Op {
+            case "!=": return value != *c.Value
+            case ">":  return value >  *c.Value
+            case "<":  return value <  *c.Value
+            default:   return value == *c.Value
+        }
+    }
+    // 键名不存在时最后修改的logid为0
+    modify := int64(0)
+    if exist {
+        if meta, ok := n.getKvMeta(c.Key); ok {
+            modify = meta.ModifyId
+        }
+    }
+    switch c.Op {
+        case "!=": return modify != *c.LogId
+        case ">":  return modify >  *c.LogId
+        case "<":  return modify <  *c.LogId
+        default:   return modify == *c.LogId
+    }
+}
+
+// 检查事务内容是否合法
+func checkKvTxn(txn *KvTxn) error {
+    for _, c := range txn.Compare {
+        if c.Key == "" {
+            return errors.New("invalid compare: k is required")
+        }
+        if (c.Value == nil) == (c.LogId == nil) {
+            return errors.New("invalid compare: one of v and logid is required, key: " + c.Key)
+        }
+        switch c.Op {
+            case "", "=", "!=", ">", "<":
+            default:
+                return errors.New("invalid compare op: " + c.Op)
+        }
+    }
+    for _, list := range [][]KvTxnOp{txn.Then, txn.Else} {
+        for _, op := range list {
+            if op.Key == "" {
+                return errors.New("invalid operation: k is required")
+            }
+            if op.Op != "set" && op.Op != "delete" {
+                return errors.New("invalid operation op: " + op.Op)
+            }
+            if err := checkElectionKeys(op.Key); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// 将操作列表按照顺序合并为日志项，同一键名以最后一个操作为准
+func makeKvTxnItems(ops []KvTxnOp) KvTxnItems {
+    set    := make(map[string]string)
+    remove := make(map[string]bool)
+    for _, op := range ops {
+        if op.Op == "set" {
+            set[op.Key] = op.Value
+            delete(remove, op.Key)
+        } else {
+            remove[op.Key] = true
+            delete(set, op.Key)
+        }
+    }
+    items := KvTxnItems {
+        Set    : set,
+        Remove : make([]string, 0, len(remove)),
+    }
+    for k, _ := range remove {
+        items.Remove = append(items.Remove, k)
+    }
+    return items
+}
@@ -0,0 +1,142 @@
+package dister
+
+import (
+    "testing"
+    "gitee.com/johng/gf/g/net/gipv4"
+    "gitee.com/johng/gf/g/encoding/gbinary"
+)
+
+// 消息头编码后解码应当一致
+func TestDecodeMsg(t *testing.T) {
+    n    := NewServer()
+    info := &NodeInfo {
+        Name             : "node1",
+        Group            : "group1",
+        Id               : "1A2B3C4D",
+        Ip               : "192.168.1.10",
+        Role             : gROLE_SERVER,
+        RaftRole         : gROLE_RAFT_LEADER,
+        LastLogId        : 1001,
+        LastServiceLogId : 1002,
+        Term             : 7,
+        CommitLogId      : 999,
+        Version          : gVERSION,
+    }
+    origin := &LogOrigin{Node: "1A2B3C4D", Ip: "10.0.0.1"}
+    b, err := n.encodeMsg(gMSG_RAFT_HI, []byte("body"), info, origin)
+    if err != nil {
+        t.Fatal(err)
+    }
+    msg := n.decodeMsg(b)
+    if msg == nil {
+        t.Fatal("decoding failed")
+    }
+    if msg.Head != gMSG_RAFT_HI || string(msg.Body) != "body" {
+        t.Errorf("head or body mismatch: %d, %s", msg.Head, msg.Body)
+    }
+    i := msg.Info
+    if i.Name != info.Name || i.Group != info.Group || i.Id != info.Id || i.Ip != info.Ip ||
+        i.Role != info.Role || i.RaftRole != info.RaftRole || i.LastLogId != info.LastLogId ||
+        i.LastServiceLogId != info.LastServiceLogId || i.Term != info.Term ||
+        i.CommitLogId != info.CommitLogId || i.Version != gVERSION {
+        t.Errorf("node info mismatch: %+v", i)
+    }
+    if msg.Origin == nil || msg.Origin.Node != origin.Node || msg.Origin.Ip != origin.Ip {
+        t.Errorf("origin mismatch: %+v", msg.Origin)
+    }
+}
+
+// 长度不足的消息返回nil而不是panic
+func TestDecodeMsgShort(t *testing.T) {
+    n    := NewServer()
+    b, _ := n.encodeMsg(gMSG_RAFT_HI, []byte("body"), &NodeInfo{Name: "node1", Group: "group1", Id: "1", Ip: "127.0.0.1"}, nil)
+    // 固定部分(不含版本号)结束的位置: 8 + 4(body) + 4 + 5(name) + 4 + 6(group) + 32
+    fixed := 8 + 4 + 4 + 5 + 4 + 6 + 32
+    for i := 0; i < fixed; i++ {
+        if msg := n.decodeMsg(b[:i]); msg != nil {
+            t.Errorf("length %d: expected nil, got %+v", i, msg)
+        }
+    }
+    // 长度字段为负数或者超出消息长度
+    cases := [][]interface{} {
+        {int32(1)},
+        {int32(1), int32(-1)},
+        {int32(1), int32(100)},
+        {int32(1), int32(0), int32(-1), int32(0)},
+        {int32(1), int32(0), int32(0), int32(100)},
+    }
+    for k, v := range cases {
+        b, _ := gbinary.Encode(v...)
+        if msg := n.decodeMsg(b); msg != nil {
+            t.Errorf("case %d: expected nil, got %+v", k, msg)
+        }
+    }
+}
+
+// 旧版本节点的消息头(不含任期、已提交logid及来源信息)可以解码，版本号保持原样以便被丢弃
+func TestDecodeMsgLegacy(t *testing.T) {
+    n    := NewServer()
+    name := []byte("node1")
+    b, _ := gbinary.Encode(
+        int32(gMSG_RAFT_HI),
+        int32(0),
+        []byte{},
+        int32(len(name)),
+        name,
+        int32(0),
+        []byte{},
+        uint32(1),
+        gipv4.Ip2long("192.168.1.10"),
+        int32(gROLE_SERVER),
+        int32(gROLE_RAFT_FOLLOWER),
+        int64(100),
+        int64(200),
+        []byte("1.6"),
+    )
+    msg := n.decodeMsg(b)
+    if msg == nil {
+        t.Fatal("decoding failed")
+    }
+    if msg.Info.Version != "1.6" || msg.Info.Term != 0 || msg.Info.CommitLogId != 0 || msg.Origin != nil {
+        t.Errorf("legacy header decoded wrongly: %+v", msg.Info)
+    }
+    if msg.Info.LastLogId != 100 || msg.Info.LastServiceLogId != 200 || msg.Info.Name != "node1" {
+        t.Errorf("legacy header decoded wrongly: %+v", msg.Info)
+    }
+}
+
+// score选举模式下leader比较：日志更新者胜出，日志相同时依次比较优先级、比分节点数以及比分，完全相同时本节点胜出
+func TestCompareLeaderWithRemoteNodeByDetail(t *testing.T) {
+    cases := []struct {
+        logid    int64
+        priority int32
+        count    int32
+        score    int64
+        expect   bool
+    } {
+        // 日志更新者胜出，与优先级及比分无关
+        {99,  9, 9, 999, true},
+        {101, 0, 0, 0,   false},
+        // 日志相同时优先级高者胜出
+        {100, 0, 9, 999, true},
+        {100, 2, 0, 0,   false},
+        // 优先级相同时比分节点数多者胜出
+        {100, 1, 1, 999, true},
+        {100, 1, 3, 0,   false},
+        // 比分节点数相同时比分高者胜出，完全相同时本节点胜出
+        {100, 1, 2, 100, true},
+        {100, 1, 2, 300, false},
+        {100, 1, 2, 200, true},
+    }
+    n := NewServer()
+    n.setLastLogId(100)
+    n.setLeaderPriority(1)
+    n.addScoreCount()
+    n.addScoreCount()
+    n.addScore(200)
+    for k, v := range cases {
+        if r := n.compareLeaderWithRemoteNodeByDetail(v.logid, v.priority, v.count, v.score); r != v.expect {
+            t.Errorf("case %d: expect %v, got %v", k, v.expect, r)
+        }
+    }
+}
@@ -0,0 +1,213 @@
+// KV数据监听(watch)
+// 监听请求给定调用方最后一次获取到的logid，如果该logid之后已有匹配的数据变化，那么立即返回，
+// 否则阻塞等待，直到saveLogEntryToVar写入了匹配的数据变化，或者等待超时；
+// 给定的logid已被日志压缩时无法返回其后的数据变化，立即返回日志压缩点，由调用方重新读取完整数据之后从返回的logid继续监听
+package dister
+
+import (
+    "fmt"
+    "sort"
+    "time"
+    "strings"
+)
+
+// KV数据监听对象
+type Watcher struct {
+    key    string        // 监听的键名或者键名前缀
+    prefix bool          // 是否按照键名前缀进行匹配
+    notify chan struct{} // 数据变化通知
+}
+
+// 判断键名是否匹配监听条件
+func (w *Watcher) match(k string) bool {
+    if w.prefix {
+        return strings.HasPrefix(k, w.key)
+    }
+    return k == w.key
+}
+
+// 添加监听对象
+func (n *Node) addWatcher(key string, prefix bool) *Watcher {
+    w := &Watcher {
+        key    : key,
+        prefix : prefix,
+        notify : make(chan struct{}, 1),
+    }
+    n.Watchers.Set(fmt.Sprintf("%p", w), w)
+    return w
+}
+
+// 删除监听对象
+func (n *Node) removeWatcher(w *Watcher) {
+    n.Watchers.Remove(fmt.Sprintf("%p", w))
+}
+
+// LogEntry写入内存变量后，通知匹配的监听对象
+func (n *Node) notifyWatchers(entry *LogEntry) {
+    if n.Watchers.Size() == 0 {
+        return
+    }
+    events := n.getWatchEventsFromLogEntry(entry)
+    for _, v := range n.Watchers.Values() {
+        w := v.(*Watcher)
+        for _, e := range events {
+            if w.match(e.Key) {
+                // 通知只需要一个即可，被通知方会重新从日志中检索数据变化
+                select {
+                    case w.notify <- struct{}{}:
+                    default:
+                }
+                break
+            }
+        }
+    }
+}
+
+// 将LogEntry转换为数据变化事件列表，同一LogEntry中的事件按照键名排序
+func (n *Node) getWatchEventsFromLogEntry(entry *LogEntry) []WatchEvent {
+    events := make([]WatchEvent, 0)
+    switch entry.Act {
+        case gMSG_REPL_DATA_SET:
+            if m, ok := entry.Items.(map[string]interface{}); ok {
+                items := make(map[string]string, len(m))
+                for k, v := range m {
+                    items[k] = fmt.Sprintf("%v", v)
+                }
+                events = appendSetWatchEvents(events, entry.Id, items)
+            }
+
+        case gMSG_REPL_DATA_REMOVE:
+            if l, ok := entry.Items.([]interface{}); ok {
+                keys := make([]string, 0, len(l))
+                for _, v := range l {
+                    keys = append(keys, fmt.Sprintf("%v", v))
+                }
+                events = appendRemoveWatchEvents(events, entry.Id, keys)
+            }
+
+        case gMSG_REPL_DATA_SET_TTL:
+            var t KvTtlItems
+            if n.decodeLogEntryItems(entry, &t) == nil {
+                events = appendSetWatchEvents(events, entry.Id, t.Items)
+            }
+
+        case gMSG_REPL_DATA_SET_SESSION:
+            var t KvSessionItems
+            if n.decodeLogEntryItems(entry, &t) == nil {
+                events = appendSetWatchEvents(events, entry.Id, t.Items)
+            }
+
+        case gMSG_REPL_DATA_TXN:
+            var t KvTxnItems
+            if n.decodeLogEntryItems(entry, &t) == nil {
+                events = appendRemoveWatchEvents(events, entry.Id, t.Remove)
+                events = appendSetWatchEvents(events, entry.Id, t.Set)
+            }
+
+        case gMSG_REPL_SESSION_DESTROY:
+            var t SessionDestroyItems
+            if n.decodeLogEntryItems(entry, &t) == nil {
+                events = appendRemoveWatchEvents(events, entry.Id, t.Keys)
+                events = appendWinnerWatchEvents(events, entry.Id, t.Winners)
+            }
+
+        case gMSG_REPL_LOCK_ACQUIRE, gMSG_REPL_LOCK_RELEASE:
+            var t LockRequest
+            if n.decodeLogEntryItems(entry, &t) == nil {
+                events = appendWinnerWatchEvents(events, entry.Id, t.Winners)
+            }
+    }
+    return events
+}
+
+// 按照键名顺序添加键值设置事件
+func appendSetWatchEvents(events []WatchEvent, id int64, items map[string]string) []WatchEvent {
+    keys := make([]string, 0, len(items))
+    for k, _ := range items {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    for _, k := range keys {
+        events = append(events, WatchEvent{id, "set", k, items[k]})
+    }
+    return events
+}
+
+// 添加选举锁交接时写入的当选信息设置事件
+func appendWinnerWatchEvents(events []WatchEvent, id int64, winners []KvSessionItems) []WatchEvent {
+    for _, w := range winners {
+        events = appendSetWatchEvents(events, id, w.Items)
+    }
+    return events
+}
+
+// 按照键名顺序添加键值删除事件
+func appendRemoveWatchEvents(events []WatchEvent, id int64, keys []string) []WatchEvent {
+    list := make([]string, len(keys))
+    copy(list, keys)
+    sort.Strings(list)
+    for _, k := range list {
+        events = append(events, WatchEvent{id, "remove", k, ""})
+    }
+    return events
+}
+
+// 从日志中检索指定logid之后匹配的数据变化事件，返回事件列表及已检索到的最大logid
+func (n *Node) getWatchEventsByLogId(w *Watcher, logid int64) ([]WatchEvent, int64) {
+    events := make([]WatchEvent, 0)
+    for {
+        list := n.getLogEntriesByLastLogId(logid, 10000, false)
+        if len(list) == 0 {
+            break
+        }
+        for _, v := range list {
+            entry := v
+            // 尚未应用的日志不一定已经提交，不返回给监听方
+            if entry.Id > n.getAppliedLogId() {
+                return events, logid
+            }
+            for _, e := range n.getWatchEventsFromLogEntry(&entry) {
+                if w.match(e.Key) {
+                    events = append(events, e)
+                }
+            }
+            logid = entry.Id
+        }
+        if len(events) > 0 {
+            break
+        }
+    }
+    return events, logid
+}
+
+// 阻塞监听KV数据变化，直到有匹配的数据变化或者超时(毫秒)，当logid<=0时表示从当前最新的数据开始监听
+func (n *Node) watchData(key string, prefix bool, logid int64, timeout int64) *WatchResult {
+    if logid <= 0 {
+        logid = n.getAppliedLogId()
+    } else if compactId := n.getCompactLogId(); logid < compactId {
+        return &WatchResult{n.getAppliedLogId(), make([]WatchEvent, 0), compactId}
+    }
+    if timeout <= 0 {
+        timeout = gWATCH_TIMEOUT
+    } else if timeout > gWATCH_TIMEOUT_MAX {
+        timeout = gWATCH_TIMEOUT_MAX
+    }
+    // 必须先注册监听对象再检索日志，防止检索过程中产生的数据变化被遗漏
+    w := n.addWatcher(key, prefix)
+    defer n.removeWatcher(w)
+
+    timer := time.NewTimer(time.Duration(timeout) * time.Millisecond)
+    defer timer.Stop()
+    for {
+        events, lastid := n.getWatchEventsByLogId(w, logid)
+        logid = lastid
+        if len(events) > 0 {
+            return &WatchResult{logid, events, 0}
+        }
+        select {
+            case <- w.notify:
+            case <- timer.C:
+                return &WatchResult{logid, events, 0}
+        }
+    }
+}
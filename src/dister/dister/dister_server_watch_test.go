@@ -0,0 +1,25 @@
+package dister
+
+import (
+    "testing"
+)
+
+// 监听的logid已被日志压缩时立即返回日志压缩点及当前已应用的logid
+func TestWatchDataCompacted(t *testing.T) {
+    n := NewServer()
+    n.setCompactLogId(500)
+    n.setAppliedLogId(800, 1)
+    cases := []struct {
+        logid     int64
+        compacted int64
+    } {
+        {100, 500},
+        {499, 500},
+    }
+    for k, v := range cases {
+        r := n.watchData("k", false, v.logid, 1)
+        if r.Compacted != v.compacted || r.LogId != 800 || len(r.Events) != 0 {
+            t.Errorf("case %d: unexpected result %+v", k, r)
+        }
+    }
+}
@@ -0,0 +1,113 @@
+// 见证节点(witness)
+// 用于双机房部署时作为第三方仲裁：witness节点是投票成员，参与选举投票及多数派写入确认，但不会发起选举成为leader，也不存储DataMap及Service数据；
+// leader发送给witness节点的LogEntry只包含logid、操作类型及任期(投票成员变更除外，witness节点需要据此维护投票成员表)，
+// witness节点只记录最新的logid、任期及投票成员表并持久化到磁盘，以便重启后仍然只投票给日志不比自身旧的候选者。
+// 存在其他server节点时，写入的多数派确认中至少包含一个server节点，witness节点的确认不能单独构成多数派，
+// 保证已提交的写入在leader故障时仍然存在于其他server节点上，并且该server节点的日志不比witness节点旧，可以赢得选举
+package dister
+
+import (
+    "sync/atomic"
+    "gitee.com/johng/gf/g/os/glog"
+    "gitee.com/johng/gf/g/os/gfile"
+    "gitee.com/johng/gf/g/encoding/gjson"
+)
+
+// 判断集群角色是否可以成为投票成员
+func isVoterRole(role int32) bool {
+    return role == gROLE_SERVER || role == gROLE_WITNESS
+}
+
+func (n *Node) getWitnessFilePath() string {
+    n.mutex.RLock()
+    path := n.SavePath + gfile.Separator + "dister.witness.db"
+    n.mutex.RUnlock()
+    return path
+}
+
+// 生成发送给witness节点的LogEntry，只保留logid、操作类型及任期
+func makeWitnessLogEntry(entry *LogEntry) LogEntry {
+    e := LogEntry{Id: entry.Id, Act: entry.Act, Term: entry.Term}
+    if entry.Act == gMSG_REPL_MEMBER_ADD || entry.Act == gMSG_REPL_MEMBER_REMOVE {
+        e.Items = entry.Items
+    }
+    return e
+}
+
+// 生成发送给witness节点的LogEntry列表
+func makeWitnessLogEntries(list []LogEntry) []LogEntry {
+    array := make([]LogEntry, len(list))
+    for k, v := range list {
+        array[k] = makeWitnessLogEntry(&v)
+    }
+    return array
+}
+
+// witness节点保存LogEntry，只更新投票成员表及logid，调用方需要持有dmutex锁
+func (n *Node) saveWitnessLogEntry(entry *LogEntry) {
+    if entry.Act == gMSG_REPL_MEMBER_ADD || entry.Act == gMSG_REPL_MEMBER_REMOVE {
+        n.applyMemberChange(entry)
+    }
+    n.setLastLogId(entry.Id)
+    n.setLastLogTerm(entry.Term)
+    // 确认写入之前需要先持久化，保证重启后投票时的日志比较仍然有效
+    n.saveWitnessState()
+}
+
+// 获取witness节点的快照(logid及投票成员表)，用于leader向witness节点安装快照
+func (n *Node) getWitnessSnapshot() map[string]interface{} {
+    n.dmutex.RLock()
+    defer n.dmutex.RUnlock()
+    return map[string]interface{} {
+        "LastLogId"   : n.getLastLogId(),
+        "LastLogTerm" : n.getLastLogTerm(),
+        "Voters"      : *n.Voters.Clone(),
+    }
+}
+
+// 持久化witness节点的logid及投票成员表
+func (n *Node) saveWitnessState() {
+    content, err := gjson.Encode(map[string]interface{} {
+        "LastLogId"   : n.getLastLogId(),
+        "LastLogTerm" : n.getLastLogTerm(),
+        "Voters"      : *n.Voters.Clone(),
+    })
+    if err != nil {
+        glog.Error(err)
+        return
+    }
+    if err := writeFileAtomically(n.getWitnessFilePath(), content); err != nil {
+        glog.Error("saving witness state error:", err)
+    }
+}
+
+// witness节点安装leader发送的快照
+func (n *Node) loadWitnessSnapshot(j *gjson.Json) int64 {
+    voters := make(map[string]Member)
+    if j.Get("Voters") != nil {
+        if err := j.GetToVar("Voters", &voters); err != nil {
+            glog.Error(err)
+        }
+    }
+    n.Voters.Clear()
+    for k, v := range voters {
+        n.Voters.Set(k, v)
+    }
+    id := j.GetInt64("LastLogId")
+    atomic.StoreInt64(&n.LastLogId, id)
+    n.setLastLogTerm(j.GetInt64("LastLogTerm"))
+    return id
+}
+
+// 从磁盘恢复witness节点的logid及投票成员表
+func (n *Node) restoreWitnessState() {
+    path := n.getWitnessFilePath()
+    if !gfile.Exists(path) {
+        return
+    }
+    j, err := gjson.DecodeToJson(gfile.GetBinContents(path))
+    if err != nil {
+        glog.Fatal(err)
+    }
+    n.loadWitnessSnapshot(j)
+}